@@ -1,6 +1,6 @@
 module github.com/kevinconway/wrapgen/v2
 
-go 1.15
+go 1.16
 
 require (
 	github.com/Masterminds/goutils v1.1.0 // indirect
@@ -14,5 +14,7 @@ require (
 	github.com/mitchellh/reflectwalk v1.0.1 // indirect
 	github.com/spf13/pflag v1.0.5
 	github.com/stretchr/testify v1.6.1 // indirect
+	golang.org/x/mod v0.15.0
 	golang.org/x/tools v0.18.0
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,75 @@
+package wrapgen
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+)
+
+// compare compares the output of a job with its destination file. A diff is
+// returned when Diff is set and an error is returned when Check is set and the
+// destination is missing or different.
+func (r *Runner) compare(dest string, output []byte) ([]byte, error) {
+	if dest == "" {
+		return nil, fmt.Errorf("a destination file is required to compare the output")
+	}
+	current, err := ioutil.ReadFile(dest)
+	exists := err == nil
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	current, output = normalize(current), normalize(output)
+	var diff []byte
+	if r.Diff {
+		oldName := dest
+		if !exists {
+			oldName = os.DevNull
+		}
+		diff = unifiedDiff(oldName, dest, current, output)
+	}
+	if r.Check && !exists {
+		return diff, fmt.Errorf("%s does not exist", dest)
+	}
+	if r.Check && !bytes.Equal(current, output) {
+		return diff, fmt.Errorf("%s is out of date", dest)
+	}
+	return diff, nil
+}
+
+// normalize removes differences in Go source code that are not meaningful,
+// such as line endings and formatting, so that a file that was formatted
+// after being generated still matches the unformatted output. The version
+// line of the header is removed so that a file generated by another version
+// of wrapgen still matches.
+func normalize(src []byte) []byte {
+	src = bytes.Replace(src, []byte("\r\n"), []byte("\n"), -1)
+	src = removeVersion(src)
+	if formatted, err := format.Source(src); err == nil {
+		return formatted
+	}
+	return src
+}
+
+// versionPrefix begins the line of the header that records the version of
+// wrapgen.
+const versionPrefix = "// Version: "
+
+// removeVersion removes the version line from the header of a generated file.
+// Only the comment lines that follow the generated line are considered.
+func removeVersion(src []byte) []byte {
+	lines := bytes.SplitAfter(src, []byte("\n"))
+	for x := 0; x < len(lines); x = x + 1 {
+		if string(bytes.TrimRight(lines[x], "\n")) != GeneratedPrefix {
+			continue
+		}
+		for y := x + 1; y < len(lines) && bytes.HasPrefix(lines[y], []byte("//")); y = y + 1 {
+			if bytes.HasPrefix(lines[y], []byte(versionPrefix)) {
+				return bytes.Join(append(lines[:y:y], lines[y+1:]...), nil)
+			}
+		}
+		break
+	}
+	return src
+}
@@ -0,0 +1,162 @@
+package wrapgen
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFiles are the names searched for, in order, when no config file is
+// given to `wrapgen run`.
+var ConfigFiles = []string{"wrapgen.yaml", "wrapgen.yml", "wrapgen.json"}
+
+// Config is a set of jobs that are rendered together.
+type Config struct {
+	// Concurrency is the maximum number of jobs rendered at once. Zero means
+	// one job per CPU.
+	Concurrency int    `json:"concurrency" yaml:"concurrency"`
+	Jobs        []*Job `json:"jobs" yaml:"jobs"`
+}
+
+// Job is a single rendering of a template. The fields match the flags of the
+// same name.
+type Job struct {
+	Source      string            `json:"source" yaml:"source"`
+	Interfaces  []string          `json:"interfaces" yaml:"interfaces"`
+	Template    string            `json:"template" yaml:"template"`
+	Destination string            `json:"destination" yaml:"destination"`
+	Package     string            `json:"package" yaml:"package"`
+	LeftDelim   string            `json:"leftdelim" yaml:"leftdelim"`
+	RightDelim  string            `json:"rightdelim" yaml:"rightdelim"`
+	Vars        map[string]string `json:"vars" yaml:"vars"`
+	LegacyNames bool              `json:"legacy-names" yaml:"legacy-names"`
+	// License is a file whose content is placed at the top of the output as
+	// a comment.
+	License string `json:"license" yaml:"license"`
+	// TemplateSHA256 pins the template to content with the given sha256. The
+	// job fails if the template does not match.
+	TemplateSHA256 string `json:"template-sha256" yaml:"template-sha256"`
+
+	// split is set on the jobs that expand makes from a job with more than
+	// one interface.
+	split bool
+}
+
+// String identifies the job in error messages.
+func (j *Job) String() string {
+	if j.Destination != "" && j.Destination != "-" {
+		return j.Destination
+	}
+	return fmt.Sprintf("%s %s", j.Source, strings.Join(j.Interfaces, ","))
+}
+
+func (j *Job) validate() error {
+	var missing []string
+	if j.Source == "" {
+		missing = append(missing, "source")
+	}
+	if len(j.Interfaces) < 1 {
+		missing = append(missing, "interfaces")
+	}
+	if j.Template == "" {
+		missing = append(missing, "template")
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("no %s set", strings.Join(missing, " or "))
+	}
+	return nil
+}
+
+// IsDestinationPattern reports whether a destination is a template that is
+// rendered once for each interface rather than a single file.
+func IsDestinationPattern(destination string) bool {
+	return strings.Contains(destination, "{{")
+}
+
+// destinationData is given to destination patterns.
+type destinationData struct {
+	Interface destinationInterface
+}
+
+type destinationInterface struct {
+	Name string
+}
+
+// expand splits a job with a destination pattern into one job for each
+// interface. Each job writes to the file given by rendering the pattern for
+// its interface. Jobs without a pattern are returned as is.
+func (j *Job) expand() ([]*Job, error) {
+	if !IsDestinationPattern(j.Destination) {
+		return []*Job{j}, nil
+	}
+	pattern, err := parsePattern("destination", j.Destination)
+	if err != nil {
+		return nil, fmt.Errorf("invalid destination pattern: %v", err)
+	}
+	jobs := make([]*Job, 0, len(j.Interfaces))
+	for _, name := range j.Interfaces {
+		destination, err := renderPattern(pattern, name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render destination pattern: %v", err)
+		}
+		if destination == "" {
+			return nil, fmt.Errorf("destination pattern is empty for %s", name)
+		}
+		job := *j
+		job.Interfaces = []string{name}
+		job.Destination = destination
+		job.split = len(j.Interfaces) > 1
+		jobs = append(jobs, &job)
+	}
+	return jobs, nil
+}
+
+// parsePattern parses a destination pattern or the name of a file defined by
+// a template that is a pattern.
+func parsePattern(name string, text string) (*template.Template, error) {
+	return template.New(name).Funcs(sprig.TxtFuncMap()).Parse(text)
+}
+
+// renderPattern renders a pattern for an interface.
+func renderPattern(pattern *template.Template, name string) (string, error) {
+	var buf bytes.Buffer
+	data := destinationData{Interface: destinationInterface{Name: name}}
+	if err := pattern.Execute(&buf, data); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// LoadConfig reads a config file. Files with a .json extension are decoded as
+// JSON and all others as YAML. Relative paths within the file are interpreted
+// from the directory that contains it when run with a Runner whose Dir is that
+// directory.
+func LoadConfig(path string) (*Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	// Unknown fields are rejected so that a misspelled option is reported
+	// rather than silently ignored.
+	var conf Config
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		dec := json.NewDecoder(bytes.NewReader(b))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&conf)
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(b))
+		dec.KnownFields(true)
+		err = dec.Decode(&conf)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode %s: %v", path, err)
+	}
+	return &conf, nil
+}
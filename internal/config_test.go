@@ -0,0 +1,112 @@
+package wrapgen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLoadConfig(t *testing.T) {
+	root, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(root)
+
+	expected := &Config{
+		Concurrency: 2,
+		Jobs: []*Job{
+			{
+				Source:      "io",
+				Interfaces:  []string{"Reader", "Writer"},
+				Template:    "templates/basic.txt",
+				Destination: "wrappers/io.go",
+				Package:     "wrappers",
+				Vars:        map[string]string{"prefix": "Wraps"},
+				LegacyNames: true,
+			},
+		},
+	}
+	files := map[string]string{
+		"wrapgen.yaml": `
+concurrency: 2
+jobs:
+  - source: io
+    interfaces: [Reader, Writer]
+    template: templates/basic.txt
+    destination: wrappers/io.go
+    package: wrappers
+    vars:
+      prefix: Wraps
+    legacy-names: true
+`,
+		"wrapgen.json": `{
+  "concurrency": 2,
+  "jobs": [{
+    "source": "io",
+    "interfaces": ["Reader", "Writer"],
+    "template": "templates/basic.txt",
+    "destination": "wrappers/io.go",
+    "package": "wrappers",
+    "vars": {"prefix": "Wraps"},
+    "legacy-names": true
+  }]
+}`,
+	}
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+		conf, err := LoadConfig(path)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !reflect.DeepEqual(conf, expected) {
+			t.Fatalf("%s: expected %#v but got %#v", name, expected.Jobs[0], conf.Jobs[0])
+		}
+	}
+
+	path := filepath.Join(root, "typo.yaml")
+	if err := ioutil.WriteFile(path, []byte("jobs:\n  - sauce: io\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := LoadConfig(path); err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestJobExpand(t *testing.T) {
+	job := &Job{
+		Source:      "io",
+		Interfaces:  []string{"ReadCloser", "Writer"},
+		Template:    "template.txt",
+		Destination: "gen/{{ .Interface.Name | snakecase }}_wrapper.go",
+	}
+	jobs, err := job.expand()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(jobs) != 2 {
+		t.Fatalf("expected a job for each interface but got %d", len(jobs))
+	}
+	for offset, expected := range []string{"gen/read_closer_wrapper.go", "gen/writer_wrapper.go"} {
+		if jobs[offset].Destination != expected {
+			t.Errorf("expected %s but got %s", expected, jobs[offset].Destination)
+		}
+		if len(jobs[offset].Interfaces) != 1 || jobs[offset].Interfaces[0] != job.Interfaces[offset] {
+			t.Errorf("unexpected interfaces %v", jobs[offset].Interfaces)
+		}
+	}
+
+	job.Destination = "gen.go"
+	if jobs, _ := job.expand(); len(jobs) != 1 || jobs[0] != job {
+		t.Fatal("expected a job without a pattern to be kept as is")
+	}
+	job.Destination = "{{ .Missing }}.go"
+	if _, err := job.expand(); err == nil {
+		t.Fatal("expected an invalid pattern to fail")
+	}
+}
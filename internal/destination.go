@@ -0,0 +1,256 @@
+package wrapgen
+
+import (
+	"context"
+	"fmt"
+	"go/parser"
+	"go/token"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/tools/go/packages"
+)
+
+var majorVersion = regexp.MustCompile(`^v[0-9]+$`)
+
+// ParseDestination interprets a destination package given as either a
+// package name, such as "wrappers", or an import path, such as
+// "example.com/project/wrappers". Package names never contain a "/" or "."
+// so any value that does is treated as an import path. An empty value
+// results in the zero Destination which means the source package.
+func ParseDestination(value string) Destination {
+	if strings.ContainsAny(value, "/.") {
+		return Destination{Path: value}
+	}
+	return Destination{Name: value}
+}
+
+// DestinationFromFile determines the package that the given file will be a
+// part of. The import path is derived from the location of the file relative
+// to the nearest go.mod. The package name is read from the other .go files in
+// the same directory or, if there are none, derived from the directory name.
+// The path is left empty if the file is not within a module.
+func DestinationFromFile(file string) (Destination, error) {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return Destination{}, err
+	}
+	dir := filepath.Dir(file)
+	var result Destination
+	root, modPath, err := findModule(dir)
+	if err != nil {
+		return Destination{}, err
+	}
+	if root != "" {
+		rel, err := filepath.Rel(root, dir)
+		if err != nil {
+			return Destination{}, err
+		}
+		result.Path = path.Join(modPath, filepath.ToSlash(rel))
+	}
+	result.Name, err = packageNameFromDir(dir, file)
+	if err != nil {
+		return Destination{}, err
+	}
+	if result.Name == "" {
+		result.Name = packageNameFromPath(filepath.ToSlash(dir))
+	}
+	return result, nil
+}
+
+// findModule searches dir and its parents for a go.mod file. It returns the
+// directory that contains the go.mod and the module path declared in it. Both
+// are empty if there is no go.mod.
+func findModule(dir string) (string, string, error) {
+	for {
+		b, err := ioutil.ReadFile(filepath.Join(dir, "go.mod"))
+		if err == nil {
+			modPath := modfile.ModulePath(b)
+			if modPath == "" {
+				return "", "", fmt.Errorf("%s contains no module directive", filepath.Join(dir, "go.mod"))
+			}
+			return dir, modPath, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", "", err
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", "", nil
+		}
+		dir = parent
+	}
+}
+
+// packageNameFromDir reads the package clause of the non-test .go files in
+// dir other than exclude. The result is empty if there are no such files.
+func packageNameFromDir(dir string, exclude string) (string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return "", err
+	}
+	sort.Strings(files)
+	fset := token.NewFileSet()
+	for _, file := range files {
+		if file == exclude || strings.HasSuffix(file, "_test.go") {
+			continue
+		}
+		f, err := parser.ParseFile(fset, file, nil, parser.PackageClauseOnly)
+		if err != nil {
+			return "", err
+		}
+		return f.Name.Name, nil
+	}
+	return "", nil
+}
+
+// resolveDestination fills in any missing details of the destination. The
+// zero Destination is the source package. A destination with a path but no
+// name takes the name of the existing package at that path or, if there is
+// none, a name derived from the path.
+func resolveDestination(ctx context.Context, dst Destination, src *packages.Package) (Destination, error) {
+	if dst.Name == "" && dst.Path == "" {
+		return Destination{Name: src.Name, Path: src.PkgPath}, nil
+	}
+	if dst.Name != "" || dst.Path == src.PkgPath {
+		if dst.Path == src.PkgPath {
+			dst.Name = src.Name
+		}
+		return dst, nil
+	}
+	conf := &packages.Config{
+		Mode:    packages.NeedName,
+		Context: ctx,
+	}
+	pkgs, err := packages.Load(conf, dst.Path)
+	if err != nil {
+		return dst, fmt.Errorf("failed to load destination package %s: %v", dst.Path, err)
+	}
+	for _, pkg := range pkgs {
+		if pkg.PkgPath == dst.Path && pkg.Name != "" && len(pkg.Errors) < 1 {
+			dst.Name = pkg.Name
+			return dst, nil
+		}
+	}
+	dst.Name = packageNameFromPath(dst.Path)
+	return dst, nil
+}
+
+// packageNameFromPath guesses the name of a package from its import path
+// using the last path element that is not a major version suffix.
+func packageNameFromPath(pth string) string {
+	name := path.Base(pth)
+	if majorVersion.MatchString(name) && path.Dir(pth) != "." {
+		name = path.Base(path.Dir(pth))
+	}
+	name = strings.Map(func(r rune) rune {
+		if r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, name)
+	if name == "" || unicode.IsDigit([]rune(name)[0]) {
+		name = "pkg" + name
+	}
+	return name
+}
+
+// qualify chooses the package name used to reference each imported package
+// from within the destination and applies those names to every exported type
+// used by the interfaces. Types defined in the destination package are left
+// unqualified. Each import keeps its own package name unless that name is
+// already taken by another import. The source package is aliased as
+// srcPkgAlias only when its own name is taken. The returned imports exclude
+// the destination package and the returned name is the one chosen for the
+// source package.
+func qualify(dst Destination, source *Import, imports []*Import, interfaces []*Interface) ([]*Import, string) {
+	pkgNames := make(map[string]string)
+	for _, imp := range imports {
+		pkgNames[imp.Path] = imp.Package
+	}
+	var types []*TypeExported
+	for _, iface := range interfaces {
+		if t, ok := iface.SrcType.(*TypeExported); ok {
+			types = append(types, t)
+		}
+		for _, method := range iface.Methods {
+			for _, param := range append(append([]*Parameter{}, method.In...), method.Out...) {
+				walkExported(param.Type, func(t *TypeExported) {
+					types = append(types, t)
+				})
+			}
+		}
+	}
+	for _, t := range types {
+		if _, ok := pkgNames[t.Path]; !ok && t.Path != "" {
+			pkgNames[t.Path] = t.Package
+		}
+	}
+	delete(pkgNames, dst.Path)
+	delete(pkgNames, source.Path)
+
+	paths := make([]string, 0, len(pkgNames))
+	for pth := range pkgNames {
+		paths = append(paths, pth)
+	}
+	sort.Strings(paths)
+	s := newScope(nil)
+	names := map[string]string{dst.Path: ""}
+	for _, pth := range paths {
+		names[pth] = s.declare(pkgNames[pth])
+	}
+	if source.Path != dst.Path {
+		if s.taken(source.Package) {
+			names[source.Path] = s.declare(sourceAlias)
+		} else {
+			names[source.Path] = s.declare(source.Package)
+		}
+	}
+
+	for _, t := range types {
+		if name, ok := names[t.Path]; ok && t.Path != "" {
+			t.Package = name
+		}
+	}
+	qualified := make([]*Import, 0, len(imports))
+	for _, imp := range imports {
+		if imp.Path == dst.Path {
+			continue
+		}
+		qualified = append(qualified, &Import{Package: names[imp.Path], Path: imp.Path})
+	}
+	return qualified, names[source.Path]
+}
+
+// walkExported calls fn for every exported type referenced by t.
+func walkExported(t Type, fn func(*TypeExported)) {
+	switch tt := t.(type) {
+	case *TypeExported:
+		fn(tt)
+	case *TypeArray:
+		walkExported(tt.Type, fn)
+	case *TypeChan:
+		walkExported(tt.Type, fn)
+	case *TypeVariadic:
+		walkExported(tt.Type, fn)
+	case *TypePointer:
+		walkExported(tt.Type, fn)
+	case *TypeMap:
+		walkExported(tt.Key, fn)
+		walkExported(tt.Value, fn)
+	case *TypeFunc:
+		for _, in := range tt.In {
+			walkExported(in, fn)
+		}
+		for _, out := range tt.Out {
+			walkExported(out, fn)
+		}
+	}
+}
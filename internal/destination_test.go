@@ -0,0 +1,108 @@
+package wrapgen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestParseDestination(t *testing.T) {
+	var cases = []struct {
+		value    string
+		expected Destination
+	}{
+		{"", Destination{}},
+		{"wrappers", Destination{Name: "wrappers"}},
+		{"example.com/project/wrappers", Destination{Path: "example.com/project/wrappers"}},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.value, func(t *testing.T) {
+			var result = ParseDestination(tcase.value)
+			if result != tcase.expected {
+				t.Errorf("expected '%v' but got '%v'", tcase.expected, result)
+			}
+		})
+	}
+}
+
+func TestPackageNameFromPath(t *testing.T) {
+	var cases = []struct {
+		path     string
+		expected string
+	}{
+		{"example.com/project/wrappers", "wrappers"},
+		{"example.com/project/v2", "project"},
+		{"example.com/go-project", "goproject"},
+		{"example.com/3d", "pkg3d"},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.path, func(t *testing.T) {
+			var result = packageNameFromPath(tcase.path)
+			if result != tcase.expected {
+				t.Errorf("expected '%s' but got '%s'", tcase.expected, result)
+			}
+		})
+	}
+}
+
+func TestDestinationFromFile(t *testing.T) {
+	root, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(root)
+	files := map[string]string{
+		"go.mod":           "module example.com/project\n",
+		"named/a.go":       "package custom\n",
+		"named/a_test.go":  "package custom_test\n",
+		"generated/gen.go": "package wrong\n",
+	}
+	for name, content := range files {
+		name = filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := ioutil.WriteFile(name, []byte(content), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	var cases = []struct {
+		name     string
+		file     string
+		expected Destination
+	}{
+		{
+			"name from files",
+			"named/wrappers_gen.go",
+			Destination{Name: "custom", Path: "example.com/project/named"},
+		},
+		{
+			"name from directory",
+			"empty/wrappers_gen.go",
+			Destination{Name: "empty", Path: "example.com/project/empty"},
+		},
+		{
+			"ignores the destination file",
+			"generated/gen.go",
+			Destination{Name: "generated", Path: "example.com/project/generated"},
+		},
+		{
+			"module root",
+			"gen.go",
+			Destination{Name: packageNameFromPath(filepath.ToSlash(root)), Path: "example.com/project"},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			var result, err = DestinationFromFile(filepath.Join(root, tcase.file))
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if result != tcase.expected {
+				t.Errorf("expected '%v' but got '%v'", tcase.expected, result)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package wrapgen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// diffContext is the number of unchanged lines shown around each change.
+const diffContext = 3
+
+// edit is a single line of an edit script. The kind is ' ' for a line that is
+// unchanged, '-' for a line that is removed, and '+' for a line that is added.
+// The a and b fields are the offsets of the line in the old and new content.
+type edit struct {
+	kind byte
+	line string
+	a    int
+	b    int
+}
+
+// unifiedDiff renders the difference between two files in the unified format
+// used by `diff -u`. The result is empty if the files are the same.
+func unifiedDiff(oldName string, newName string, old []byte, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	edits := diffLines(splitLines(old), splitLines(new))
+	var out bytes.Buffer
+	_, _ = fmt.Fprintf(&out, "--- %s\n+++ %s\n", oldName, newName)
+	for start := 0; start < len(edits); {
+		if edits[start].kind == ' ' {
+			start = start + 1
+			continue
+		}
+		// Each hunk begins with the context before the first change and
+		// extends until the unchanged lines between two changes are too many
+		// to show as context for both.
+		end := start
+		for end < len(edits) {
+			if edits[end].kind != ' ' {
+				end = end + 1
+				continue
+			}
+			next := end
+			for next < len(edits) && edits[next].kind == ' ' {
+				next = next + 1
+			}
+			if next == len(edits) || next-end > 2*diffContext {
+				end = minInt(end+diffContext, len(edits))
+				break
+			}
+			end = next
+		}
+		writeHunk(&out, edits[maxInt(start-diffContext, 0):end])
+		start = end
+	}
+	return out.Bytes()
+}
+
+func writeHunk(out *bytes.Buffer, edits []edit) {
+	var oldCount, newCount int
+	for _, e := range edits {
+		if e.kind != '+' {
+			oldCount = oldCount + 1
+		}
+		if e.kind != '-' {
+			newCount = newCount + 1
+		}
+	}
+	// Line numbers are one based except that an empty range refers to the
+	// line before it.
+	oldStart, newStart := edits[0].a, edits[0].b
+	if oldCount > 0 {
+		oldStart = oldStart + 1
+	}
+	if newCount > 0 {
+		newStart = newStart + 1
+	}
+	_, _ = fmt.Fprintf(out, "@@ -%d,%d +%d,%d @@\n", oldStart, oldCount, newStart, newCount)
+	for _, e := range edits {
+		_ = out.WriteByte(e.kind)
+		_, _ = out.WriteString(e.line)
+		if len(e.line) == 0 || e.line[len(e.line)-1] != '\n' {
+			_, _ = out.WriteString("\n\\ No newline at end of file\n")
+		}
+	}
+}
+
+// splitLines splits content after each newline. The last line has no newline
+// if the content does not end with one.
+func splitLines(content []byte) []string {
+	var lines []string
+	for len(content) > 0 {
+		end := bytes.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		lines = append(lines, string(content[:end]))
+		content = content[end:]
+	}
+	return lines
+}
+
+// diffLines computes the shortest edit script that turns a into b using the
+// linear space variant of the algorithm from "An O(ND) Difference Algorithm
+// and Its Variations" by Eugene W. Myers. Within each run of changes the
+// removed lines come before the added ones, as they do in `diff -u`.
+func diffLines(a []string, b []string) []edit {
+	d := &differ{a: a, b: b}
+	d.compare(0, len(a), 0, len(b))
+	// Order each run of changes and number every line of the script.
+	var x, y int
+	for start := 0; start < len(d.edits); {
+		end := start
+		for end < len(d.edits) && d.edits[end].kind != ' ' {
+			end = end + 1
+		}
+		run := d.edits[start:end]
+		sort.SliceStable(run, func(i int, j int) bool {
+			return run[i].kind == '-' && run[j].kind == '+'
+		})
+		if end == start {
+			end = end + 1
+		}
+		for offset := start; offset < end; offset = offset + 1 {
+			e := &d.edits[offset]
+			e.a, e.b = x, y
+			if e.kind != '+' {
+				x = x + 1
+			}
+			if e.kind != '-' {
+				y = y + 1
+			}
+		}
+		start = end
+	}
+	return d.edits
+}
+
+// differ accumulates the edit script between two sets of lines.
+type differ struct {
+	a     []string
+	b     []string
+	edits []edit
+}
+
+// compare adds the edits that turn a[aLo:aHi] into b[bLo:bHi]. Common lines at
+// either end are matched directly and the rest is split where the shortest
+// edit script crosses its middle so that memory stays proportional to the
+// input.
+func (d *differ) compare(aLo int, aHi int, bLo int, bHi int) {
+	for aLo < aHi && bLo < bHi && d.a[aLo] == d.b[bLo] {
+		d.edits = append(d.edits, edit{kind: ' ', line: d.a[aLo]})
+		aLo, bLo = aLo+1, bLo+1
+	}
+	suffix := 0
+	for aLo < aHi-suffix && bLo < bHi-suffix && d.a[aHi-suffix-1] == d.b[bHi-suffix-1] {
+		suffix = suffix + 1
+	}
+	aEnd, bEnd := aHi-suffix, bHi-suffix
+	switch {
+	case aLo == aEnd:
+		for y := bLo; y < bEnd; y = y + 1 {
+			d.edits = append(d.edits, edit{kind: '+', line: d.b[y]})
+		}
+	case bLo == bEnd:
+		for x := aLo; x < aEnd; x = x + 1 {
+			d.edits = append(d.edits, edit{kind: '-', line: d.a[x]})
+		}
+	default:
+		x, y := d.middle(aLo, aEnd, bLo, bEnd)
+		d.compare(aLo, x, bLo, y)
+		d.compare(x, aEnd, y, bEnd)
+	}
+	for x := aEnd; x < aHi; x = x + 1 {
+		d.edits = append(d.edits, edit{kind: ' ', line: d.a[x]})
+	}
+}
+
+// middle finds a point on a shortest path through the edit graph of
+// a[aLo:aHi] and b[bLo:bHi] that lies roughly half way along it by searching
+// forward from the start and backward from the end at the same time. The
+// ranges must differ at both ends so that the point splits the problem into
+// two smaller ones.
+func (d *differ) middle(aLo int, aHi int, bLo int, bHi int) (int, int) {
+	n, m := aHi-aLo, bHi-bLo
+	max := (n + m + 1) / 2
+	// forward and backward record the furthest x reached on each diagonal
+	// k = x - y, counted from the start and from the end respectively. The
+	// diagonals are offset by max+1 and -1 marks one that was not reached.
+	offset := max + 1
+	forward := make([]int, 2*max+3)
+	backward := make([]int, 2*max+3)
+	for k := range forward {
+		forward[k], backward[k] = -1, -1
+	}
+	forward[offset+1], backward[offset+1] = 0, 0
+	delta := n - m
+	// When delta is odd the paths can only meet on a forward step.
+	odd := delta%2 != 0
+	// Diagonals that leave the edit graph are skipped.
+	var fStart, fEnd, bStart, bEnd int
+	for step := 0; step <= max; step = step + 1 {
+		for k := -step + fStart; k <= step-fEnd; k = k + 2 {
+			var x int
+			if k == -step || (k != step && forward[offset+k-1] < forward[offset+k+1]) {
+				x = forward[offset+k+1]
+			} else {
+				x = forward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aLo+x] == d.b[bLo+y] {
+				x, y = x+1, y+1
+			}
+			forward[offset+k] = x
+			switch {
+			case x > n:
+				fEnd = fEnd + 2
+			case y > m:
+				fStart = fStart + 2
+			case odd:
+				other := offset + delta - k
+				if other >= 0 && other < len(backward) && backward[other] != -1 && x >= n-backward[other] {
+					return aLo + x, bLo + y
+				}
+			}
+		}
+		for k := -step + bStart; k <= step-bEnd; k = k + 2 {
+			var x int
+			if k == -step || (k != step && backward[offset+k-1] < backward[offset+k+1]) {
+				x = backward[offset+k+1]
+			} else {
+				x = backward[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && d.a[aHi-x-1] == d.b[bHi-y-1] {
+				x, y = x+1, y+1
+			}
+			backward[offset+k] = x
+			switch {
+			case x > n:
+				bEnd = bEnd + 2
+			case y > m:
+				bStart = bStart + 2
+			case !odd:
+				other := offset + delta - k
+				if other >= 0 && other < len(forward) && forward[other] != -1 {
+					fx := forward[other]
+					fy := fx - (delta - k)
+					if fx >= n-x {
+						return aLo + fx, bLo + fy
+					}
+				}
+			}
+		}
+	}
+	// The searches always meet, so this is only reached for input that
+	// does not satisfy the preconditions. Splitting after the first line
+	// still makes progress.
+	return aLo + 1, bLo
+}
+
+func minInt(a int, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a int, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,112 @@
+package wrapgen
+
+import (
+	"fmt"
+	"runtime"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	testCases := []struct {
+		name     string
+		old      string
+		new      string
+		expected string
+	}{
+		{
+			name: "equal",
+			old:  "a\nb\n",
+			new:  "a\nb\n",
+		},
+		{
+			name: "separate hunks",
+			old:  "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\n",
+			new:  "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl",
+			expected: `--- old.go
++++ new.go
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -9,3 +9,4 @@
+ i
+ j
+ k
++l
+\ No newline at end of file
+`,
+		},
+		{
+			name: "joined hunks",
+			old:  "a\nb\nc\nd\ne\nf\ng\nh\n",
+			new:  "b\nc\nd\ne\nf\ng\nH\n",
+			expected: `--- old.go
++++ new.go
+@@ -1,8 +1,7 @@
+-a
+ b
+ c
+ d
+ e
+ f
+ g
+-h
++H
+`,
+		},
+		{
+			name: "new file",
+			old:  "",
+			new:  "a\nb\n",
+			expected: `--- old.go
++++ new.go
+@@ -0,0 +1,2 @@
++a
++b
+`,
+		},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			result := string(unifiedDiff("old.go", "new.go", []byte(testCase.old), []byte(testCase.new)))
+			if result != testCase.expected {
+				t.Fatalf("expected\n%s\nbut got\n%s", testCase.expected, result)
+			}
+		})
+	}
+}
+
+func TestDiffLinesLarge(t *testing.T) {
+	// A file that is rewritten completely is the worst case for the diff.
+	const size = 5000
+	a := make([]string, size)
+	b := make([]string, size)
+	for x := 0; x < size; x = x + 1 {
+		a[x] = fmt.Sprintf("old %d\n", x)
+		b[x] = fmt.Sprintf("new %d\n", x)
+	}
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	edits := diffLines(a, b)
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	if len(edits) != 2*size {
+		t.Fatalf("expected %d edits but got %d", 2*size, len(edits))
+	}
+	for x, e := range edits {
+		kind := byte('-')
+		if x >= size {
+			kind = '+'
+		}
+		if e.kind != kind {
+			t.Fatalf("expected every removal before every addition but edit %d is %q", x, e.kind)
+		}
+	}
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 64<<20 {
+		t.Fatalf("diff allocated %d bytes", allocated)
+	}
+}
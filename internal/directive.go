@@ -0,0 +1,225 @@
+package wrapgen
+
+import (
+	"context"
+	"fmt"
+	"go/ast"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// DirectivePrefix marks a comment on a type declaration as a request to
+// render the type. The remainder of the comment is a space separated list of
+// key=value options such as:
+//
+//	//wrapgen:generate template=logtime.txt destination=reader_gen.go
+//
+// The keys are template, template-sha256, destination, package, leftdelim,
+// rightdelim, legacy-names, license, and var.NAME which sets a template
+// variable. Values that contain spaces may be double quoted.
+const DirectivePrefix = "//wrapgen:generate"
+
+// FindDirectives loads the packages that match the given patterns and converts
+// every directive into a Job. Relative templates and destinations are
+// interpreted from the directory of the file that contains the directive.
+// Directives in the same package that differ only by the type they annotate
+// are combined into a single job that renders every annotated type.
+func FindDirectives(ctx context.Context, dir string, patterns ...string) ([]*Job, error) {
+	conf := &packages.Config{
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedSyntax,
+		Context: ctx,
+		Dir:     dir,
+	}
+	pkgs, err := packages.Load(conf, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(pkgs, func(i int, j int) bool {
+		return pkgs[i].PkgPath < pkgs[j].PkgPath
+	})
+	var (
+		jobs []*Job
+		errs []error
+	)
+	for _, pkg := range pkgs {
+		if err := packageErrors(pkg); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		merged := make(map[string]*Job)
+		typeSpecs(pkg.Syntax, func(decl *ast.GenDecl, spec *ast.TypeSpec) bool {
+			doc := spec.Doc
+			if doc == nil && !decl.Lparen.IsValid() {
+				// The comment above a declaration of a single type is
+				// attached to the declaration rather than the type.
+				doc = decl.Doc
+			}
+			if doc == nil {
+				return true
+			}
+			for _, comment := range doc.List {
+				args, ok := directiveArgs(comment.Text)
+				if !ok {
+					continue
+				}
+				pos := pkg.Fset.Position(comment.Slash)
+				job, err := parseDirective(args, filepath.Dir(pos.Filename))
+				if err != nil {
+					errs = append(errs, fmt.Errorf("%v: %v", pos, err))
+					continue
+				}
+				job.Source = pkg.PkgPath
+				key := job.key()
+				if existing, ok := merged[key]; ok {
+					existing.Interfaces = append(existing.Interfaces, spec.Name.Name)
+					continue
+				}
+				job.Interfaces = []string{spec.Name.Name}
+				merged[key] = job
+				jobs = append(jobs, job)
+			}
+			return true
+		})
+	}
+	if len(errs) > 0 {
+		return nil, multiError(errs)
+	}
+	return jobs, nil
+}
+
+// directiveArgs returns the options of a directive comment or false if the
+// comment is not a directive.
+func directiveArgs(comment string) (string, bool) {
+	if !strings.HasPrefix(comment, DirectivePrefix) {
+		return "", false
+	}
+	args := strings.TrimPrefix(comment, DirectivePrefix)
+	if args != "" && !unicode.IsSpace(rune(args[0])) {
+		return "", false
+	}
+	return strings.TrimSpace(args), true
+}
+
+// parseDirective converts the options of a directive into a Job. The job has
+// no source or interfaces.
+func parseDirective(args string, dir string) (*Job, error) {
+	fields, err := splitDirective(args)
+	if err != nil {
+		return nil, err
+	}
+	job := &Job{}
+	for _, field := range fields {
+		parts := strings.SplitN(field, "=", 2)
+		key := parts[0]
+		value := ""
+		if len(parts) > 1 {
+			value = parts[1]
+			if strings.HasPrefix(value, `"`) {
+				value, err = strconv.Unquote(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value for %s: %v", key, err)
+				}
+			}
+		}
+		switch {
+		case key == "template":
+			job.Template = value
+		case key == "template-sha256":
+			job.TemplateSHA256 = value
+		case key == "destination":
+			job.Destination = value
+		case key == "package":
+			job.Package = value
+		case key == "leftdelim":
+			job.LeftDelim = value
+		case key == "rightdelim":
+			job.RightDelim = value
+		case key == "legacy-names":
+			job.LegacyNames = true
+			if len(parts) > 1 {
+				job.LegacyNames, err = strconv.ParseBool(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value for %s: %v", key, err)
+				}
+			}
+		case key == "license":
+			job.License = value
+		case strings.HasPrefix(key, "var.") && len(key) > len("var."):
+			if job.Vars == nil {
+				job.Vars = make(map[string]string)
+			}
+			job.Vars[strings.TrimPrefix(key, "var.")] = value
+		default:
+			return nil, fmt.Errorf("unknown option %q", key)
+		}
+	}
+	if job.Template == "" {
+		return nil, fmt.Errorf("no template set")
+	}
+	if job.Destination == "" {
+		return nil, fmt.Errorf("no destination set")
+	}
+	if isLocalPath(job.Template) && !filepath.IsAbs(job.Template) {
+		job.Template = filepath.Join(dir, job.Template)
+	}
+	if !filepath.IsAbs(job.Destination) {
+		job.Destination = filepath.Join(dir, job.Destination)
+	}
+	if job.License != "" && !filepath.IsAbs(job.License) {
+		job.License = filepath.Join(dir, job.License)
+	}
+	return job, nil
+}
+
+// splitDirective splits the options of a directive on spaces that are not
+// within double quotes.
+func splitDirective(args string) ([]string, error) {
+	var (
+		fields  []string
+		current strings.Builder
+		quoted  bool
+		escaped bool
+	)
+	for _, r := range args {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case !quoted && unicode.IsSpace(r):
+			if current.Len() > 0 {
+				fields = append(fields, current.String())
+				current.Reset()
+			}
+			continue
+		}
+		_, _ = current.WriteRune(r)
+	}
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", args)
+	}
+	if current.Len() > 0 {
+		fields = append(fields, current.String())
+	}
+	return fields, nil
+}
+
+// key identifies the options of a job other than the interfaces.
+func (j *Job) key() string {
+	vars := make([]string, 0, len(j.Vars))
+	for name, value := range j.Vars {
+		vars = append(vars, strconv.Quote(name)+"="+strconv.Quote(value))
+	}
+	sort.Strings(vars)
+	return strings.Join([]string{
+		j.Source, j.Template, j.Destination, j.Package, j.LeftDelim, j.RightDelim,
+		strconv.FormatBool(j.LegacyNames), j.License, j.TemplateSHA256, strings.Join(vars, ","),
+	}, "\x00")
+}
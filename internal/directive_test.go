@@ -0,0 +1,124 @@
+package wrapgen
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseDirective(t *testing.T) {
+	testCases := []struct {
+		name     string
+		args     string
+		expected *Job
+	}{
+		{
+			name: "relative",
+			args: "template=tmpl.txt destination=out.go",
+			expected: &Job{
+				Template:    filepath.Join("dir", "tmpl.txt"),
+				Destination: filepath.Join("dir", "out.go"),
+			},
+		},
+		{
+			name: "all options",
+			args: `template=https://example.com/t.txt template-sha256=sha256:abc destination=/tmp/out.go package=wrappers leftdelim={{ rightdelim=}} legacy-names=false var.a="b c" var.d=e`,
+			expected: &Job{
+				Template:       "https://example.com/t.txt",
+				TemplateSHA256: "sha256:abc",
+				Destination:    "/tmp/out.go",
+				Package:        "wrappers",
+				LeftDelim:      "{{",
+				RightDelim:     "}}",
+				Vars:           map[string]string{"a": "b c", "d": "e"},
+			},
+		},
+		{
+			name: "builtin",
+			args: "template=builtin:logtime destination=out.go",
+			expected: &Job{
+				Template:    "builtin:logtime",
+				Destination: filepath.Join("dir", "out.go"),
+			},
+		},
+		{
+			name: "bare flag",
+			args: "  template=t.txt   legacy-names destination=out.go ",
+			expected: &Job{
+				Template:    filepath.Join("dir", "t.txt"),
+				Destination: filepath.Join("dir", "out.go"),
+				LegacyNames: true,
+			},
+		},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			job, err := parseDirective(testCase.args, "dir")
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if !reflect.DeepEqual(job, testCase.expected) {
+				t.Fatalf("expected %#v but got %#v", testCase.expected, job)
+			}
+		})
+	}
+
+	for _, args := range []string{
+		"destination=out.go",
+		"template=t.txt",
+		"template=t.txt destination=out.go unknown=true",
+		`template=t.txt destination=out.go var.a="b`,
+		"template=t.txt destination=out.go legacy-names=maybe",
+	} {
+		if _, err := parseDirective(args, "dir"); err == nil {
+			t.Fatalf("expected an error for %q", args)
+		}
+	}
+}
+
+func TestDirectiveArgs(t *testing.T) {
+	if args, ok := directiveArgs("//wrapgen:generate template=t.txt"); !ok || args != "template=t.txt" {
+		t.Fatalf("directive was not recognized: %q", args)
+	}
+	if _, ok := directiveArgs("//wrapgen:generated"); ok {
+		t.Fatal("a different directive was recognized")
+	}
+	if _, ok := directiveArgs("// wrapgen:generate"); ok {
+		t.Fatal("a plain comment was recognized")
+	}
+}
+
+func TestFindDirectives(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	dir := filepath.Join(wd, "test", "directive")
+	jobs, err := FindDirectives(context.Background(), "", "./test/...")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	source := "github.com/kevinconway/wrapgen/v2/internal/test/directive"
+	expected := []*Job{
+		{
+			Source:      source,
+			Interfaces:  []string{"Reader", "Writer"},
+			Template:    filepath.Join(wd, "..", "templates", "basic.txt"),
+			Destination: filepath.Join(dir, "io_gen.go"),
+		},
+		{
+			Source:      source,
+			Interfaces:  []string{"Closer"},
+			Template:    "https://example.com/overrider.txt",
+			Destination: filepath.Join(dir, "closer_gen.go"),
+			Vars:        map[string]string{"prefix": "Test Closer"},
+			LegacyNames: true,
+		},
+	}
+	if !reflect.DeepEqual(jobs, expected) {
+		t.Fatalf("expected %v but got %v", expected, jobs)
+	}
+}
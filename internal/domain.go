@@ -3,6 +3,7 @@ package wrapgen
 import (
 	"context"
 	"fmt"
+	"go/token"
 	"strings"
 )
 
@@ -19,11 +20,18 @@ func (t TypeBuiltin) String() string { return string(t) }
 
 // TypeExported is a user defined type that is exported from a package.
 type TypeExported struct {
+	// Package is the name used to qualify the type. It is empty when the type
+	// is defined in the destination package.
 	Package string
-	Type    Type
+	// Path is the import path of the package that defines the type.
+	Path string
+	Type Type
 }
 
 func (t *TypeExported) String() string {
+	if t.Package == "" {
+		return t.Type.String()
+	}
 	return fmt.Sprintf("%s.%s", t.Package, t.Type.String())
 }
 
@@ -123,6 +131,17 @@ type Package struct {
 	// ImportsWithSource will contain Source if the destination package is set and
 	// Source is not included in Imports.
 	ImportsWithSource []*Import
+	// Vars are arbitrary values given to the template by the caller.
+	Vars map[string]string
+
+	names *scope
+}
+
+// Destination is the package that rendered code will be part of. The zero
+// value is the source package.
+type Destination struct {
+	Name string
+	Path string
 }
 
 // Import is a package name and path that is imported by another package.
@@ -133,7 +152,7 @@ type Import struct {
 
 // Interface is an exported interface defined in a package.
 type Interface struct {
-	SrcType Type // e.g. srcPkgAlias.ExportedType
+	SrcType Type // e.g. pkg.ExportedType
 	Name    string
 	Methods []*Method
 }
@@ -143,6 +162,11 @@ type Method struct {
 	Name string
 	In   []*Parameter
 	Out  []*Parameter
+
+	names *scope
+	// pkgPath is the import path of the package that declares the method.
+	pkgPath string
+	pos     token.Position
 }
 
 // Parameter is a named parameter used by a Method.
@@ -12,6 +12,7 @@ func TestModels(t *testing.T) {
 	}{
 		{"builtin", TypeBuiltin("bool"), "bool"},
 		{"exported", &TypeExported{Package: "testpkg", Type: TypeBuiltin("test")}, "testpkg.test"},
+		{"exported local", &TypeExported{Path: "example.com/testpkg", Type: TypeBuiltin("test")}, "test"},
 		{"array as slice", &TypeArray{Len: -1, Type: TypeBuiltin("bool")}, "[]bool"},
 		{"array with len", &TypeArray{Len: 10, Type: TypeBuiltin("bool")}, "[10]bool"},
 		{"chan no direction", &TypeChan{ReadOnly: false, WriteOnly: false, Type: TypeBuiltin("bool")}, "chan bool"},
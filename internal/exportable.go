@@ -0,0 +1,71 @@
+package wrapgen
+
+import (
+	"fmt"
+	"go/ast"
+)
+
+// checkExportable reports every part of the given interfaces that cannot be
+// referenced or implemented from within the destination package. Unexported
+// interfaces and unexported types cannot be named outside of the package
+// that declares them and an interface with an unexported method can only be
+// implemented within the package that declares the method. Everything is
+// allowed when the destination is the declaring package.
+func checkExportable(dst Destination, interfaces []*Interface) error {
+	var errs []error
+	for _, iface := range interfaces {
+		if t, ok := iface.SrcType.(*TypeExported); ok && !visible(dst, t) {
+			errs = append(errs, fmt.Errorf(
+				"interface %s is unexported and cannot be referenced outside of %s",
+				t.Type.String(), t.Path,
+			))
+		}
+		for _, method := range iface.Methods {
+			where := fmt.Sprintf("method %s of interface %s", method.Name, iface.Name)
+			if method.pos.IsValid() {
+				where = fmt.Sprintf("%s: %s", method.pos, where)
+			}
+			if !ast.IsExported(method.Name) && method.pkgPath != dst.Path {
+				errs = append(errs, fmt.Errorf(
+					"%s is unexported and cannot be implemented outside of %s",
+					where, method.pkgPath,
+				))
+			}
+			for offset, param := range method.In {
+				errs = append(errs, checkParameter(dst, where, "parameter", offset, param)...)
+			}
+			for offset, param := range method.Out {
+				errs = append(errs, checkParameter(dst, where, "result", offset, param)...)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return multiError(errs)
+	}
+	return nil
+}
+
+func checkParameter(dst Destination, where string, kind string, offset int, param *Parameter) []error {
+	// Unnamed parameters are not yet named when this check runs so they are
+	// identified by their position instead.
+	var label = param.Name
+	if label == "" {
+		label = fmt.Sprintf("%d", offset)
+	}
+	var errs []error
+	walkExported(param.Type, func(t *TypeExported) {
+		if visible(dst, t) {
+			return
+		}
+		errs = append(errs, fmt.Errorf(
+			"%s: %s %s uses unexported type %s which cannot be referenced outside of %s",
+			where, kind, label, t.Type.String(), t.Path,
+		))
+	})
+	return errs
+}
+
+// visible reports whether the type may be referenced from the destination.
+func visible(dst Destination, t *TypeExported) bool {
+	return t.Path == "" || t.Path == dst.Path || ast.IsExported(t.Type.String())
+}
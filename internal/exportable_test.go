@@ -0,0 +1,61 @@
+package wrapgen
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestExportableSamePackage(t *testing.T) {
+	ctx := context.Background()
+	names := []string{
+		"unexportedInterface",
+		"unexportedInterfaceWithEmbedded",
+		"ExportedInterfaceWithUnexportedMethod",
+	}
+	if _, err := LoadPackage(ctx, "./test/happy", Destination{}, names, LoadOptions{}); err != nil {
+		t.Fatalf("rejected unexported identifiers in the same package: %v", err)
+	}
+}
+
+func TestExportableOtherPackage(t *testing.T) {
+	ctx := context.Background()
+	var cases = []struct {
+		name     string
+		iface    string
+		expected []string
+	}{
+		{
+			"unexported interface",
+			"unexportedInterface",
+			[]string{
+				"interface unexportedInterface is unexported",
+				"happy.go:",
+				"method D of interface unexportedInterface: parameter one uses unexported type unexportedStruct",
+				"method D of interface unexportedInterface: parameter two uses unexported type unexportedStruct",
+			},
+		},
+		{
+			"unexported method",
+			"ExportedInterfaceWithUnexportedMethod",
+			[]string{
+				"method a of interface ExportedInterfaceWithUnexportedMethod is unexported",
+				"method B of interface ExportedInterfaceWithUnexportedMethod: parameter 0 uses unexported type unexportedStruct",
+				"method B of interface ExportedInterfaceWithUnexportedMethod: result 0 uses unexported type unexportedStruct",
+			},
+		},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			_, err := LoadPackage(ctx, "./test/happy", Destination{Name: "wrappers"}, []string{tcase.iface}, LoadOptions{})
+			if err == nil {
+				t.Fatal("accepted unexported identifiers in another package")
+			}
+			for _, expected := range tcase.expected {
+				if !strings.Contains(err.Error(), expected) {
+					t.Errorf("expected '%s' in '%s'", expected, err.Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package wrapgen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/scanner"
+
+	"golang.org/x/tools/imports"
+)
+
+// formatContext is the number of generated lines shown before and after a
+// line that contains a syntax error.
+const formatContext = 2
+
+// formatSource formats generated code in the same way as goimports. Missing
+// imports are added and unused imports are removed. The filename is used to
+// find the package that the code is a part of and may be empty.
+func formatSource(filename string, src []byte) ([]byte, error) {
+	result, err := imports.Process(filename, src, &imports.Options{
+		Comments:  true,
+		TabIndent: true,
+		TabWidth:  8,
+	})
+	if err != nil {
+		return nil, newSyntaxError(src, err)
+	}
+	return result, nil
+}
+
+// syntaxError describes invalid generated code. The error is shown along with
+// the generated lines around it and, if a source map is available, the part of
+// the template that produced it.
+type syntaxError struct {
+	src  []byte
+	errs scanner.ErrorList
+	smap *sourceMap
+}
+
+func newSyntaxError(src []byte, err error) error {
+	var list scanner.ErrorList
+	if !errors.As(err, &list) {
+		var single scanner.Error
+		if !errors.As(err, &single) {
+			return fmt.Errorf("generated code is not valid Go: %v", err)
+		}
+		list = scanner.ErrorList{&single}
+	}
+	if len(list) < 1 {
+		return fmt.Errorf("generated code is not valid Go: %v", err)
+	}
+	return &syntaxError{src: src, errs: list}
+}
+
+func (e *syntaxError) Error() string {
+	// Only the first error is shown because the parser often reports a
+	// cascade of errors that all stem from the first.
+	err := e.errs[0]
+	var buf bytes.Buffer
+	location := ""
+	if e.smap != nil {
+		location = e.smap.locate(e.src, err.Pos.Line, err.Pos.Column)
+	}
+	if location != "" {
+		_, _ = fmt.Fprintf(&buf, "%s: %s", location, err.Msg)
+	} else {
+		_, _ = fmt.Fprintf(&buf, "generated code is not valid Go: %d:%d: %s", err.Pos.Line, err.Pos.Column, err.Msg)
+	}
+	if len(e.errs) > 1 {
+		_, _ = fmt.Fprintf(&buf, " (and %d more errors)", len(e.errs)-1)
+	}
+	writeContext(&buf, e.src, err.Pos.Line, formatContext)
+	return buf.String()
+}
+
+// writeContext writes the given generated line along with the given number of
+// lines before and after it.
+func writeContext(buf *bytes.Buffer, src []byte, line int, context int) {
+	lines := bytes.Split(src, []byte("\n"))
+	first := maxInt(line-context, 1)
+	last := minInt(line+context, len(lines))
+	for current := first; current <= last; current = current + 1 {
+		marker := " "
+		if current == line {
+			marker = ">"
+		}
+		_, _ = fmt.Fprintf(buf, "\n%s %4d | %s", marker, current, lines[current-1])
+	}
+}
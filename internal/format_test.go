@@ -0,0 +1,71 @@
+package wrapgen
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestFormatSource(t *testing.T) {
+	src := `package wrappers
+import (
+	io "io"
+	os "os"
+)
+type WrapsReader struct { wrapped io.Reader }
+func (w *WrapsReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	defer func() { _ = time.Since(start) }()
+	return w.wrapped.Read(p)
+}
+`
+	expected := `package wrappers
+
+import (
+	io "io"
+	"time"
+)
+
+type WrapsReader struct{ wrapped io.Reader }
+
+func (w *WrapsReader) Read(p []byte) (int, error) {
+	start := time.Now()
+	defer func() { _ = time.Since(start) }()
+	return w.wrapped.Read(p)
+}
+`
+	result, err := formatSource("", []byte(src))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(result) != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, result)
+	}
+}
+
+func TestFormatSourceSyntaxError(t *testing.T) {
+	src := `package wrappers
+
+type WrapsReader struct{}
+
+func (w *WrapsReader) Read(p []byte) (int, error {
+	return 0, nil
+}
+
+var x = 1
+`
+	_, err := formatSource("", []byte(src))
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	expected := strings.Join([]string{
+		"5:50: missing ',' in parameter list (and 3 more errors)",
+		"     3 | type WrapsReader struct{}",
+		"     4 | ",
+		">    5 | func (w *WrapsReader) Read(p []byte) (int, error {",
+		"     6 | \treturn 0, nil",
+		"     7 | }",
+	}, "\n")
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("expected\n%s\nin\n%s", expected, err.Error())
+	}
+}
@@ -0,0 +1,100 @@
+package wrapgen
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// GoGenerate is the environment that `go generate` provides to the commands
+// that it runs. Commands are run from the directory of File.
+type GoGenerate struct {
+	// File is the base name of the file that contains the directive.
+	File string
+	// Package is the name of the package that contains File.
+	Package string
+	// Line is the line number of the directive within File.
+	Line int
+}
+
+// GoGenerateFromEnv reads the GOFILE, GOPACKAGE, and GOLINE variables using
+// the given lookup function, such as os.Getenv. The result is false if the
+// variables are not set which means the command is not run by `go generate`.
+func GoGenerateFromEnv(getenv func(string) string) (GoGenerate, bool, error) {
+	result := GoGenerate{
+		File:    getenv("GOFILE"),
+		Package: getenv("GOPACKAGE"),
+	}
+	if result.File == "" || result.Package == "" {
+		return GoGenerate{}, false, nil
+	}
+	line := getenv("GOLINE")
+	if line == "" {
+		return result, true, nil
+	}
+	var err error
+	result.Line, err = strconv.Atoi(line)
+	if err != nil {
+		return GoGenerate{}, false, fmt.Errorf("invalid GOLINE %q: %v", line, err)
+	}
+	return result, true, nil
+}
+
+// NextType returns the name of the interface declared after the directive.
+// The dir is the directory that contains File which is the working directory
+// when run by `go generate`. An error is returned if the first type declared
+// after the directive is not an interface. Types that refer to another type
+// are accepted because whether they are interfaces is only known once the
+// package is loaded.
+func (g GoGenerate) NextType(dir string) (string, error) {
+	file := filepath.Join(dir, g.File)
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file, nil, 0)
+	if err != nil {
+		return "", err
+	}
+	var next *ast.TypeSpec
+	typeSpecs([]*ast.File{f}, func(_ *ast.GenDecl, spec *ast.TypeSpec) bool {
+		if fset.Position(spec.Name.Pos()).Line > g.Line {
+			next = spec
+			return false
+		}
+		return true
+	})
+	if next == nil {
+		return "", fmt.Errorf("no interface is declared after line %d of %s", g.Line, file)
+	}
+	switch next.Type.(type) {
+	case *ast.InterfaceType, *ast.Ident, *ast.SelectorExpr:
+		return next.Name.Name, nil
+	}
+	return "", fmt.Errorf("no interface is declared after line %d of %s: the next type %s is not an interface", g.Line, file, next.Name.Name)
+}
+
+// DefaultDestination suggests a file name for the output of a template
+// rendered for the given interfaces. For example, the Reader interface
+// rendered with the templates/logtime.txt template is written to
+// reader_logtime_gen.go.
+func DefaultDestination(template string, interfaces []string) string {
+	name := path.Base(filepath.ToSlash(template))
+	if offset := strings.LastIndex(name, ":"); offset > -1 {
+		name = name[offset+1:]
+	}
+	name = strings.TrimSuffix(name, path.Ext(name))
+	if template == StdinPath {
+		name = ""
+	}
+	parts := make([]string, 0, len(interfaces)+1)
+	for _, iface := range interfaces {
+		parts = append(parts, strings.ToLower(iface))
+	}
+	if name != "" {
+		parts = append(parts, strings.ToLower(name))
+	}
+	return strings.Join(parts, "_") + "_gen.go"
+}
@@ -0,0 +1,82 @@
+package wrapgen
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestGoGenerateFromEnv(t *testing.T) {
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+	if _, ok, err := GoGenerateFromEnv(getenv); ok || err != nil {
+		t.Fatalf("expected no go generate environment but got %v %v", ok, err)
+	}
+
+	env["GOFILE"] = "file.go"
+	env["GOPACKAGE"] = "pkg"
+	env["GOLINE"] = "12"
+	gen, ok, err := GoGenerateFromEnv(getenv)
+	if err != nil || !ok {
+		t.Fatalf("expected a go generate environment but got %v %v", ok, err)
+	}
+	if gen != (GoGenerate{File: "file.go", Package: "pkg", Line: 12}) {
+		t.Fatalf("unexpected environment %#v", gen)
+	}
+
+	env["GOLINE"] = "twelve"
+	if _, _, err := GoGenerateFromEnv(getenv); err == nil {
+		t.Fatal("expected an error for an invalid GOLINE")
+	}
+}
+
+func TestGoGenerateNextType(t *testing.T) {
+	dir := filepath.Join("test", "directive")
+	testCases := []struct {
+		line     int
+		expected string
+	}{
+		{line: 1, expected: "Reader"},
+		{line: 7, expected: "Reader"},
+		{line: 8, expected: "Writer"},
+		{line: 12, expected: "Writer"},
+		{line: 17, expected: "Closer"},
+		{line: 24, expected: "Seeker"},
+	}
+	for _, testCase := range testCases {
+		gen := GoGenerate{File: "directive.go", Package: "directive", Line: testCase.line}
+		name, err := gen.NextType(dir)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if name != testCase.expected {
+			t.Fatalf("line %d: expected %s but got %s", testCase.line, testCase.expected, name)
+		}
+	}
+	for line, expected := range map[int]string{
+		28:  "the next type Options is not an interface",
+		100: "no interface is declared after line 100",
+	} {
+		gen := GoGenerate{File: "directive.go", Package: "directive", Line: line}
+		if _, err := gen.NextType(dir); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("line %d: expected %q but got %v", line, expected, err)
+		}
+	}
+}
+
+func TestDefaultDestination(t *testing.T) {
+	testCases := []struct {
+		template   string
+		interfaces []string
+		expected   string
+	}{
+		{template: "templates/logtime.txt", interfaces: []string{"Reader"}, expected: "reader_logtime_gen.go"},
+		{template: "https://example.com/t/overrider.txt", interfaces: []string{"Reader", "Writer"}, expected: "reader_writer_overrider_gen.go"},
+		{template: "builtin:fake", interfaces: []string{"ReadCloser"}, expected: "readcloser_fake_gen.go"},
+	}
+	for _, testCase := range testCases {
+		if result := DefaultDestination(testCase.template, testCase.interfaces); result != testCase.expected {
+			t.Fatalf("expected %s but got %s", testCase.expected, result)
+		}
+	}
+}
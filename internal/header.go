@@ -0,0 +1,146 @@
+package wrapgen
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// GeneratedPrefix begins the first line of every header. The complete line
+// matches the form that Go tooling uses to recognize generated files.
+const GeneratedPrefix = "// Code generated by wrapgen. DO NOT EDIT."
+
+// version returns the version of the wrapgen module that is running. Builds
+// from a source checkout report "(devel)".
+func version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok || info.Main.Version == "" {
+		return "(devel)"
+	}
+	return info.Main.Version
+}
+
+// header renders the comment that is placed at the top of the output of a
+// job. It records how the output was made so that it can be reproduced, and
+// begins with the job's license, if any. The output is the file that the
+// header is written to, or empty for Stdout. Files defined by the template
+// record the destination of the job as their primary because they are
+// reproduced along with it.
+func (r *Runner) header(job *Job, pkg *packages.Package, templateText string, output string) ([]byte, error) {
+	var buf bytes.Buffer
+	if job.License != "" {
+		license, err := ioutil.ReadFile(r.path(job.License))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read license: %v", err)
+		}
+		_, _ = buf.WriteString(commentText(string(license)))
+		_, _ = buf.WriteString("\n")
+	}
+	_, _ = fmt.Fprintf(&buf, "%s\n//\n", GeneratedPrefix)
+	_, _ = fmt.Fprintf(&buf, "%s%s\n", versionPrefix, version())
+	_, _ = fmt.Fprintf(&buf, "// Source: %s\n", pkg.PkgPath)
+	_, _ = fmt.Fprintf(&buf, "// Interfaces: %s\n", strings.Join(job.Interfaces, ", "))
+	_, _ = fmt.Fprintf(&buf, "// Template: %s (sha256:%x)\n", location(output, r.templatePath(job.Template)), sha256.Sum256([]byte(templateText)))
+	if options := r.headerOptions(job, output); options != "" {
+		_, _ = fmt.Fprintf(&buf, "// Options: %s\n", options)
+	}
+	if dest := r.destination(job); output != dest {
+		_, _ = fmt.Fprintf(&buf, "// Primary: %s\n", location(output, dest))
+	}
+	if r.Command != nil {
+		if command := r.Command(job); command != "" {
+			_, _ = fmt.Fprintf(&buf, "// Command: %s\n", command)
+		}
+	}
+	_, _ = buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// headerOptions records the options of a job that are not otherwise part of
+// the header in the syntax of a directive so that the job can be recreated.
+func (r *Runner) headerOptions(job *Job, output string) string {
+	var options []string
+	add := func(key string, value string) {
+		if strings.ContainsAny(value, " \t\"") {
+			value = strconv.Quote(value)
+		}
+		options = append(options, key+"="+value)
+	}
+	if job.TemplateSHA256 != "" {
+		add("template-sha256", job.TemplateSHA256)
+	}
+	if job.Package != "" {
+		add("package", job.Package)
+	}
+	if job.LeftDelim != "" && job.LeftDelim != defaultLeftDelim {
+		add("leftdelim", job.LeftDelim)
+	}
+	if job.RightDelim != "" && job.RightDelim != defaultRightDelim {
+		add("rightdelim", job.RightDelim)
+	}
+	if job.LegacyNames {
+		options = append(options, "legacy-names")
+	}
+	if job.License != "" {
+		add("license", location(output, r.path(job.License)))
+	}
+	names := make([]string, 0, len(job.Vars))
+	for name := range job.Vars {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		add("var."+name, job.Vars[name])
+	}
+	return strings.Join(options, " ")
+}
+
+// location describes a file used to render the output in a way that does not
+// depend on where wrapgen was run. Files are given relative to the output when
+// it is a file.
+func location(output string, file string) string {
+	if !isLocalPath(file) || output == "" {
+		return filepath.ToSlash(file)
+	}
+	absFile, err := filepath.Abs(file)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	absOutput, err := filepath.Abs(output)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	rel, err := filepath.Rel(filepath.Dir(absOutput), absFile)
+	if err != nil {
+		return filepath.ToSlash(file)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// commentText converts text into line comments. Text that is already a
+// comment is left as is.
+func commentText(text string) string {
+	text = strings.TrimRight(strings.Replace(text, "\r\n", "\n", -1), "\n")
+	trimmed := strings.TrimSpace(text)
+	if strings.HasPrefix(trimmed, "//") || strings.HasPrefix(trimmed, "/*") {
+		return text + "\n"
+	}
+	var buf strings.Builder
+	for _, line := range strings.Split(text, "\n") {
+		line = strings.TrimRight(line, " \t")
+		if line == "" {
+			_, _ = buf.WriteString("//\n")
+			continue
+		}
+		_, _ = fmt.Fprintf(&buf, "// %s\n", line)
+	}
+	return buf.String()
+}
@@ -0,0 +1,106 @@
+package wrapgen
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestRunnerHeader(t *testing.T) {
+	root, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(root)
+
+	template := "package #! .Name !#\n"
+	files := map[string]string{
+		"template.txt": template,
+		"LICENSE":      "Copyright Someone.\n\nAll rights reserved.\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	var stdout bytes.Buffer
+	runner := &Runner{
+		Fetcher: &FSTemplateFetcher{ReadFn: ioutil.ReadFile},
+		Stdout:  &stdout,
+		Command: func(job *Job) string {
+			return "wrapgen run --config wrapgen.yaml"
+		},
+	}
+	job := &Job{
+		Source:      "io",
+		Interfaces:  []string{"Reader", "Writer"},
+		Template:    filepath.Join(root, "template.txt"),
+		Destination: filepath.Join(root, "out", "gen.go"),
+		Package:     "out",
+		License:     filepath.Join(root, "LICENSE"),
+	}
+	if err := runner.Run(context.Background(), []*Job{job}); err != nil {
+		t.Fatal(err.Error())
+	}
+	b, err := ioutil.ReadFile(filepath.Join(root, "out", "gen.go"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := strings.Join([]string{
+		"// Copyright Someone.",
+		"//",
+		"// All rights reserved.",
+		"",
+		"// Code generated by wrapgen. DO NOT EDIT.",
+		"//",
+		"// Version: " + version(),
+		"// Source: io",
+		"// Interfaces: Reader, Writer",
+		fmt.Sprintf("// Template: ../template.txt (sha256:%x)", sha256.Sum256([]byte(template))),
+		"// Options: package=out license=../LICENSE",
+		"// Command: wrapgen run --config wrapgen.yaml",
+		"",
+		"package out",
+		"",
+	}, "\n")
+	if string(b) != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, string(b))
+	}
+	// This is the form that Go tooling uses to recognize generated files.
+	if !regexp.MustCompile(`(?m)^// Code generated .* DO NOT EDIT\.$`).Match(b) {
+		t.Fatal("the header does not mark the file as generated")
+	}
+
+	runner.NoHeader = true
+	job.Destination = "-"
+	if err := runner.Run(context.Background(), []*Job{job}); err != nil {
+		t.Fatal(err.Error())
+	}
+	if stdout.String() != "package out\n" {
+		t.Fatalf("expected no header but got %q", stdout.String())
+	}
+}
+
+func TestCommentText(t *testing.T) {
+	testCases := []struct {
+		text     string
+		expected string
+	}{
+		{text: "one\n\ntwo  \n", expected: "// one\n//\n// two\n"},
+		{text: "// one\n// two", expected: "// one\n// two\n"},
+		{text: "/*\none\n*/\n", expected: "/*\none\n*/\n"},
+		{text: "one\r\ntwo\r\n", expected: "// one\n// two\n"},
+	}
+	for _, testCase := range testCases {
+		if result := commentText(testCase.text); result != testCase.expected {
+			t.Errorf("%q: expected %q but got %q", testCase.text, testCase.expected, result)
+		}
+	}
+}
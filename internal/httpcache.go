@@ -0,0 +1,74 @@
+package wrapgen
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// cachedTemplate is a template downloaded by HTTPTemplateFetcher along with
+// the validators needed to ask the origin whether it has changed.
+type cachedTemplate struct {
+	URL          string `json:"url"`
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+	Body         string `json:"body"`
+}
+
+// httpCache stores one file per URL in a directory. The file is named
+// after a hash of the URL so that any URL can be stored.
+type httpCache string
+
+func (c httpCache) file(url string) string {
+	return filepath.Join(string(c), fmt.Sprintf("%x.json", sha256.Sum256([]byte(url))))
+}
+
+// load returns the cached copy of a URL or nil if there is none. A cache entry
+// that cannot be read is treated as missing.
+func (c httpCache) load(url string) *cachedTemplate {
+	if c == "" {
+		return nil
+	}
+	b, err := ioutil.ReadFile(c.file(url))
+	if err != nil {
+		return nil
+	}
+	var entry cachedTemplate
+	if err := json.Unmarshal(b, &entry); err != nil || entry.URL != url {
+		return nil
+	}
+	return &entry
+}
+
+// store records a successful response. Failing to write the cache does not
+// fail the fetch because the cache only saves work.
+func (c httpCache) store(url string, resp *http.Response, body string) {
+	if c == "" {
+		return
+	}
+	b, err := json.Marshal(&cachedTemplate{
+		URL:          url,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         body,
+	})
+	if err != nil {
+		return
+	}
+	_ = writeFile(c.file(url), b)
+}
+
+// DefaultCacheDir returns the directory in which downloaded templates are
+// cached. This is a wrapgen directory within $XDG_CACHE_HOME or the platform's
+// equivalent.
+func DefaultCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "wrapgen"), nil
+}
@@ -0,0 +1,83 @@
+package wrapgen
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync/atomic"
+	"testing"
+)
+
+func TestHTTPTemplateFetcherCache(t *testing.T) {
+	cacheDir, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(cacheDir)
+
+	var (
+		requests    int32
+		revalidated int32
+		failing     int32
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		if r.Header.Get("If-None-Match") == `"v1"` {
+			atomic.AddInt32(&revalidated, 1)
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", `"v1"`)
+		_, _ = w.Write([]byte("i am template"))
+	}))
+	defer server.Close()
+
+	ctx := context.Background()
+	url := server.URL + "/t.txt"
+	fetch := func(fetcher *HTTPTemplateFetcher) {
+		t.Helper()
+		tmpl, err := fetcher.FetchTemplate(ctx, url)
+		if err != nil {
+			t.Fatalf("http did not fetch: %v", err)
+		}
+		if tmpl != "i am template" {
+			t.Fatalf("http fetched wrong template: %s", tmpl)
+		}
+	}
+
+	offline := &HTTPTemplateFetcher{Client: server.Client(), CacheDir: cacheDir, Offline: true}
+	if _, err := offline.FetchTemplate(ctx, url); err == nil {
+		t.Fatal("offline fetched a template that was not cached")
+	}
+	if atomic.LoadInt32(&requests) != 0 {
+		t.Fatal("offline made a request")
+	}
+
+	fetcher := &HTTPTemplateFetcher{Client: server.Client(), CacheDir: cacheDir}
+	fetch(fetcher)
+	fetch(fetcher)
+	if atomic.LoadInt32(&requests) != 2 || atomic.LoadInt32(&revalidated) != 1 {
+		t.Fatalf("expected the cached template to be revalidated but made %d requests with %d revalidated", requests, revalidated)
+	}
+
+	fetch(offline)
+	if atomic.LoadInt32(&requests) != 2 {
+		t.Fatal("offline made a request")
+	}
+
+	atomic.StoreInt32(&failing, 1)
+	fetch(fetcher)
+	server.Close()
+	fetch(fetcher)
+
+	uncached := &HTTPTemplateFetcher{Client: server.Client()}
+	if _, err := uncached.FetchTemplate(ctx, url); err == nil {
+		t.Fatal("http fetched from an unreachable server without a cache")
+	}
+}
@@ -0,0 +1,201 @@
+package wrapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"sort"
+	"strconv"
+	"text/template"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// importSet records the imports that a template registers with the import
+// and importAs functions while it renders. The names chosen for registered
+// imports are reserved in the package scope so that they never collide with
+// the imports of the model, the parameters of any method, or identifiers from
+// fresh.
+type importSet struct {
+	ctx context.Context
+	dir string
+	pkg *Package
+	// names holds the name chosen for each alias and path pair so that
+	// registering an import more than once gives the same name.
+	names map[[2]string]string
+	// packageNames holds the name that each imported package declares for
+	// itself. The name is empty for packages that cannot be loaded.
+	packageNames map[string]string
+	// file holds the imports registered while rendering the current file.
+	file []*Import
+}
+
+// newImportSet creates an importSet that loads imported packages from dir to
+// learn their names.
+func newImportSet(ctx context.Context, dir string) *importSet {
+	return &importSet{
+		ctx:          ctx,
+		dir:          dir,
+		names:        make(map[[2]string]string),
+		packageNames: make(map[string]string),
+	}
+}
+
+// funcs returns the functions that must be installed in the template before
+// it is executed.
+func (s *importSet) funcs() template.FuncMap {
+	return template.FuncMap{
+		"import":   s.importPath,
+		"importAs": s.importAs,
+	}
+}
+
+// reset starts a new file that is rendered with the given package.
+func (s *importSet) reset(pkg *Package) {
+	s.pkg = pkg
+	s.file = nil
+}
+
+// importPath registers an import of the given path and returns the name to
+// reference it by. An import that is already part of the model is reused.
+func (s *importSet) importPath(path string) (string, error) {
+	if s.pkg == nil {
+		return "", fmt.Errorf("import used outside of a template")
+	}
+	for _, imp := range s.pkg.ImportsWithSource {
+		if imp.Path == path {
+			return imp.Package, nil
+		}
+	}
+	return s.importAs(s.packageName(path), path)
+}
+
+// packageName returns the name that the package at the given path declares.
+// The name is guessed from the path if the package cannot be loaded.
+func (s *importSet) packageName(path string) string {
+	name, ok := s.packageNames[path]
+	if !ok {
+		conf := &packages.Config{
+			Mode:    packages.NeedName,
+			Context: s.ctx,
+			Dir:     s.dir,
+		}
+		pkgs, err := packages.Load(conf, path)
+		if err == nil && len(pkgs) == 1 && len(pkgs[0].Errors) < 1 {
+			name = pkgs[0].Name
+		}
+		s.packageNames[path] = name
+	}
+	if name == "" {
+		return packageNameFromPath(path)
+	}
+	return name
+}
+
+// importAs registers an import of the given path with a preferred name and
+// returns the name to reference it by. The name has a number appended if the
+// preferred name is already taken.
+func (s *importSet) importAs(name string, path string) (string, error) {
+	if s.pkg == nil {
+		return "", fmt.Errorf("importAs used outside of a template")
+	}
+	if !token.IsIdentifier(name) || name == "_" {
+		return "", fmt.Errorf("invalid import name %q", name)
+	}
+	for _, imp := range s.pkg.ImportsWithSource {
+		if imp.Path == path && imp.Package == name {
+			return name, nil
+		}
+	}
+	key := [2]string{name, path}
+	result, ok := s.names[key]
+	if !ok {
+		// The name of the package decides whether the import needs a name
+		// of its own.
+		_ = s.packageName(path)
+		result = s.pkg.scope().declare(name)
+		s.names[key] = result
+	}
+	for _, imp := range s.file {
+		if imp.Package == result && imp.Path == path {
+			return result, nil
+		}
+	}
+	s.file = append(s.file, &Import{Package: result, Path: path})
+	return result, nil
+}
+
+// addImports adds an import declaration to the output for every import that
+// it uses but does not declare. Those are the registered imports and the
+// imports of the model that are referenced. Registered imports are given an
+// explicit name unless it is the name in packageNames, which holds the names
+// that packages declare for themselves, because the name a template refers
+// to may not match the path. Output that does not parse is left alone so that
+// the syntax error is reported by the formatter. The source map of the file is
+// updated to account for the inserted text.
+func addImports(file *outputFile, pkg *Package, registered []*Import, packageNames map[string]string) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, file.path, file.content, 0)
+	if err != nil {
+		return
+	}
+	declared := make(map[Import]bool)
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		name := packageNameFromPath(path)
+		if spec.Name != nil {
+			name = spec.Name.Name
+		}
+		declared[Import{Package: name, Path: path}] = true
+	}
+	// Package names are unresolved identifiers on the left of a selector.
+	referenced := make(map[string]bool)
+	ast.Inspect(f, func(node ast.Node) bool {
+		if sel, ok := node.(*ast.SelectorExpr); ok {
+			if ident, ok := sel.X.(*ast.Ident); ok && ident.Obj == nil {
+				referenced[ident.Name] = true
+			}
+		}
+		return true
+	})
+	var missing []*Import
+	// named holds the imports that are written with their name.
+	named := make(map[*Import]bool)
+	for _, imp := range pkg.ImportsWithSource {
+		if referenced[imp.Package] && !declared[*imp] {
+			declared[*imp] = true
+			missing = append(missing, imp)
+			named[imp] = imp.Package != packageNameFromPath(imp.Path)
+		}
+	}
+	for _, imp := range registered {
+		if !declared[*imp] {
+			declared[*imp] = true
+			missing = append(missing, imp)
+			named[imp] = imp.Package != packageNames[imp.Path]
+		}
+	}
+	if len(missing) < 1 {
+		return
+	}
+	sort.Slice(missing, func(i int, j int) bool {
+		return missing[i].Path < missing[j].Path
+	})
+	var decl bytes.Buffer
+	_, _ = decl.WriteString("\n\nimport (\n")
+	for _, imp := range missing {
+		if !named[imp] {
+			_, _ = fmt.Fprintf(&decl, "\t%q\n", imp.Path)
+			continue
+		}
+		_, _ = fmt.Fprintf(&decl, "\t%s %q\n", imp.Package, imp.Path)
+	}
+	_, _ = decl.WriteString(")")
+	file.insert(fset.Position(f.Name.End()).Offset, decl.Bytes())
+}
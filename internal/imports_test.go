@@ -0,0 +1,178 @@
+package wrapgen
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestAddImports(t *testing.T) {
+	pkg := &Package{
+		Name: "wrappers",
+		ImportsWithSource: []*Import{
+			{Package: "io", Path: "io"},
+			{Package: "http", Path: "net/http"},
+			{Package: "url", Path: "net/url"},
+		},
+	}
+	testCases := []struct {
+		name       string
+		src        string
+		registered []*Import
+		names      map[string]string
+		expected   string
+	}{
+		{
+			name:     "referenced model imports",
+			src:      "package wrappers\n\nvar _ io.Reader\n\nfunc f(url T) { _ = url.Host }\n",
+			expected: "package wrappers\n\nimport (\n\t\"io\"\n)\n\nvar _ io.Reader\n\nfunc f(url T) { _ = url.Host }\n",
+		},
+		{
+			name:       "registered imports",
+			src:        "package wrappers\n\nvar _ = t.Now\n",
+			registered: []*Import{{Package: "t", Path: "time"}},
+			expected:   "package wrappers\n\nimport (\n\tt \"time\"\n)\n\nvar _ = t.Now\n",
+		},
+		{
+			name:       "declared imports",
+			src:        "package wrappers\n\nimport \"io\"\n\nvar _ io.Reader\nvar _ = time.Now\n",
+			registered: []*Import{{Package: "time", Path: "time"}},
+			names:      map[string]string{"time": "time"},
+			expected:   "package wrappers\n\nimport (\n\t\"time\"\n)\n\nimport \"io\"\n\nvar _ io.Reader\nvar _ = time.Now\n",
+		},
+		{
+			name:       "registered imports with unknown names",
+			src:        "package wrappers\n\nvar _ = foo.New\n",
+			registered: []*Import{{Package: "foo", Path: "example.com/foo"}},
+			expected:   "package wrappers\n\nimport (\n\tfoo \"example.com/foo\"\n)\n\nvar _ = foo.New\n",
+		},
+		{
+			name:     "nothing missing",
+			src:      "package wrappers\n\nimport \"io\"\n\nvar _ io.Reader\n",
+			expected: "package wrappers\n\nimport \"io\"\n\nvar _ io.Reader\n",
+		},
+		{
+			name:       "invalid",
+			src:        "package wrappers\n\nvar _ = (\n",
+			registered: []*Import{{Package: "time", Path: "time"}},
+			expected:   "package wrappers\n\nvar _ = (\n",
+		},
+	}
+	for _, testCase := range testCases {
+		file := &outputFile{
+			path:    "wrappers.go",
+			content: []byte(testCase.src),
+			smap:    &sourceMap{out: bytes.NewBufferString(testCase.src)},
+		}
+		addImports(file, pkg, testCase.registered, testCase.names)
+		if string(file.content) != testCase.expected {
+			t.Errorf("%s: expected\n%s\nbut got\n%s", testCase.name, testCase.expected, string(file.content))
+		}
+	}
+}
+
+func TestRunnerImports(t *testing.T) {
+	template := strings.Join([]string{
+		"package #! .Name !#",
+		"",
+		"#! range .Interfaces !##! range .Methods !#",
+		"func Log#! .Name !#(#! range .In !##! .Name !# #! .Type !#, #! end !#) {",
+		`	#! import "log" !#.Println(#! import "time" !#.Now(), #! importAs "fmt" "fmt" !#.Sprint("#! .Name !#"))`,
+		"}",
+		"#! end !##! end !#",
+	}, "\n")
+	var stdout bytes.Buffer
+	runner, _ := newTestRunner(t, template)
+	runner.Stdout = &stdout
+	// The parameters of Log are named time and log which forces the imports
+	// of the same names to be aliased.
+	err := runner.Run(context.Background(), []*Job{{
+		Source:     "./test/imports",
+		Interfaces: []string{"Logger"},
+		Template:   "template.txt",
+		Package:    "wrappers",
+	}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := strings.Join([]string{
+		"package wrappers",
+		"",
+		"import (",
+		`	"fmt"`,
+		`	log1 "log"`,
+		`	time1 "time"`,
+		"",
+		`	"github.com/kevinconway/wrapgen/v2/internal/test/imports"`,
+		")",
+		"",
+		"func LogLog(time imports.Time, log string) {",
+		`	log1.Println(time1.Now(), fmt.Sprint("Log"))`,
+		"}",
+		"",
+	}, "\n")
+	if stdout.String() != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, stdout.String())
+	}
+
+	// Problems are still reported at the template line that produced them
+	// after the imports are inserted.
+	template = "package #! .Name !#\n\nvar _ = #! import \"time\" !#.Now\nvar _ = undefined\n"
+	var buf bytes.Buffer
+	smap := newSourceMap("template.txt", template)
+	imports := newImportSet(context.Background(), "")
+	tmpl, err := NewTemplate("", "").Funcs(smap.funcs()).Funcs(imports.funcs()).Parse(template)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	smap.instrument(tmpl)
+	smap.reset(&buf)
+	pkg := &Package{Name: "wrappers"}
+	imports.reset(pkg)
+	if err := tmpl.Execute(&buf, pkg); err != nil {
+		t.Fatal(err.Error())
+	}
+	file := &outputFile{path: "wrappers.go", content: buf.Bytes(), smap: smap.reset(nil)}
+	addImports(file, pkg, imports.file, imports.packageNames)
+	if !bytes.Contains(file.content, []byte("import (\n\t\"time\"\n)")) {
+		t.Fatalf("expected time to be imported in\n%s", file.content)
+	}
+	// The undefined name is on line 8 of the output after the imports.
+	if result := file.smap.locate(file.content, 8, 9); result != "template.txt:4" {
+		t.Fatalf("expected template.txt:4 but got %q", result)
+	}
+}
+
+func TestRunnerImportsPackageName(t *testing.T) {
+	// The last element of each path is not the name of its package.
+	template := strings.Join([]string{
+		"package #! .Name !#",
+		"",
+		`var _ = #! import "gopkg.in/yaml.v3" !#.Marshal`,
+		`var _ = #! import "github.com/kevinconway/wrapgen/v2/internal/test/imports/go-logger" !#.New`,
+		"",
+	}, "\n")
+	var stdout bytes.Buffer
+	runner, _ := newTestRunner(t, template)
+	runner.Stdout = &stdout
+	err := runner.Run(context.Background(), []*Job{readerJob("", "wrappers")})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := strings.Join([]string{
+		"package wrappers",
+		"",
+		"import (",
+		`	"github.com/kevinconway/wrapgen/v2/internal/test/imports/go-logger"`,
+		`	"gopkg.in/yaml.v3"`,
+		")",
+		"",
+		"var _ = yaml.Marshal",
+		"var _ = logger.New",
+		"",
+	}, "\n")
+	if stdout.String() != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, stdout.String())
+	}
+}
@@ -0,0 +1,267 @@
+package wrapgen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// LockFileName is the name of the file that records the content hash of every
+// remote template.
+const LockFileName = "wrapgen.lock"
+
+// VendorDirName is the directory beside the lock file into which remote
+// templates are vendored. Go tooling ignores directories that begin with an
+// underscore.
+const VendorDirName = "_wrapgen"
+
+// Lock records the sha256 of the content of every remote template that has
+// been rendered. A remote template is one that is neither a file, a built in
+// template, nor standard input. The first time a remote template is rendered
+// its hash is added to the lock, and every later render fails if the content
+// of the template no longer matches.
+type Lock struct {
+	// Path is the location of the lock file.
+	Path    string
+	lock    sync.Mutex
+	sums    map[string]string
+	changed bool
+}
+
+// FindLock returns the path of the lock file that applies to dir. This is
+// the lock file in the nearest directory above dir that contains a go.mod, or
+// within dir itself if there is no such directory.
+func FindLock(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for current := dir; ; {
+		if _, err := os.Stat(filepath.Join(current, "go.mod")); err == nil {
+			return filepath.Join(current, LockFileName), nil
+		}
+		parent := filepath.Dir(current)
+		if parent == current {
+			return filepath.Join(dir, LockFileName), nil
+		}
+		current = parent
+	}
+}
+
+// ReadLock parses a lock file. A missing file gives an empty lock that is
+// created when it is written.
+func ReadLock(path string) (*Lock, error) {
+	l := &Lock{Path: path, sums: make(map[string]string)}
+	content, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return l, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("%s:%d: expected a template and its sha256", path, line)
+		}
+		sum, err := parseSHA256(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %v", path, line, err)
+		}
+		l.sums[fields[0]] = sum
+	}
+	return l, scanner.Err()
+}
+
+// Templates returns the remote templates in the lock and the sha256 of each.
+func (l *Lock) Templates() map[string]string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	result := make(map[string]string, len(l.sums))
+	for template, sum := range l.sums {
+		result[template] = sum
+	}
+	return result
+}
+
+// verify checks the content of a template against the lock. Remote templates
+// that are not yet locked are added to it.
+func (l *Lock) verify(template string, text string) error {
+	if !isRemotePath(template) {
+		return nil
+	}
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte(text)))
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	locked, ok := l.sums[template]
+	if !ok {
+		l.sums[template] = sum
+		l.changed = true
+		return nil
+	}
+	if locked != sum {
+		return fmt.Errorf("template %s has sha256 %s but %s records %s", template, sum, filepath.Base(l.Path), locked)
+	}
+	return nil
+}
+
+// Write saves the lock file if any template was added to it.
+func (l *Lock) Write() error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if !l.changed {
+		return nil
+	}
+	templates := make([]string, 0, len(l.sums))
+	for template := range l.sums {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+	var buf bytes.Buffer
+	for _, template := range templates {
+		_, _ = fmt.Fprintf(&buf, "%s sha256:%s\n", template, l.sums[template])
+	}
+	if err := writeFile(l.Path, buf.Bytes()); err != nil {
+		return err
+	}
+	l.changed = false
+	return nil
+}
+
+// verifySHA256 checks the content of a template against a sha256 given as
+// hex digits with an optional sha256: prefix.
+func verifySHA256(template string, text string, expected string) error {
+	expected, err := parseSHA256(expected)
+	if err != nil {
+		return err
+	}
+	if sum := fmt.Sprintf("%x", sha256.Sum256([]byte(text))); sum != expected {
+		return fmt.Errorf("template %s has sha256 %s but %s is required", template, sum, expected)
+	}
+	return nil
+}
+
+func parseSHA256(value string) (string, error) {
+	sum := strings.ToLower(strings.TrimPrefix(value, "sha256:"))
+	if len(sum) != sha256.Size*2 || strings.Trim(sum, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid sha256 %q", value)
+	}
+	return sum, nil
+}
+
+// isRemotePath reports whether a template path refers to content that may
+// change outside of the repository.
+func isRemotePath(path string) bool {
+	switch templateScheme(path) {
+	case "", "file", "builtin", StdinPath:
+		return false
+	}
+	return true
+}
+
+// vendorPath gives the location within dir of the vendored copy of a remote
+// template. The scheme is part of the location because the same host and path
+// may serve different content over each scheme.
+func vendorPath(dir string, template string) (string, error) {
+	u, err := url.Parse(template)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" || u.RawQuery != "" {
+		return "", fmt.Errorf("template %s cannot be vendored", template)
+	}
+	host := strings.Replace(u.Host, ":", "_", -1)
+	return filepath.Join(dir, u.Scheme, host, filepath.FromSlash(path.Clean("/"+u.Path))), nil
+}
+
+// VendoredTemplateFetcher loads remote templates from the copies that
+// Vendor writes to Dir. Templates that are not vendored are loaded with
+// Fetcher.
+type VendoredTemplateFetcher struct {
+	Dir     string
+	Fetcher TemplateFetcher
+}
+
+// FetchTemplate loads the vendored copy of the template if there is one.
+func (f *VendoredTemplateFetcher) FetchTemplate(ctx context.Context, path string) (string, error) {
+	if file, err := vendorPath(f.Dir, path); err == nil {
+		b, err := ioutil.ReadFile(file)
+		if err == nil {
+			return string(b), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+	return f.Fetcher.FetchTemplate(ctx, path)
+}
+
+// Vendor copies every template in the lock into dir so that rendering does
+// not depend on the network. Each template is checked against the lock and
+// nothing in dir is changed unless all of them are. The templates are written
+// to a temporary directory that then replaces dir along with anything else in
+// it.
+func Vendor(ctx context.Context, fetcher TemplateFetcher, lock *Lock, dir string) error {
+	sums := lock.Templates()
+	templates := make([]string, 0, len(sums))
+	for template := range sums {
+		templates = append(templates, template)
+	}
+	sort.Strings(templates)
+	texts := make(map[string]string, len(templates))
+	var errs []error
+	for _, template := range templates {
+		if _, err := vendorPath(dir, template); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		text, err := fetcher.FetchTemplate(ctx, template)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to fetch template %s: %v", template, err))
+			continue
+		}
+		if err := verifySHA256(template, text, sums[template]); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		texts[template] = text
+	}
+	if len(errs) > 0 {
+		return multiError(errs)
+	}
+	parent := filepath.Dir(dir)
+	if err := os.MkdirAll(parent, 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir(parent, "."+filepath.Base(dir)+".tmp")
+	if err != nil {
+		return err
+	}
+	// The temporary directory is removed unless it replaces dir.
+	defer os.RemoveAll(tmp)
+	if err := os.Chmod(tmp, 0755); err != nil {
+		return err
+	}
+	for _, template := range templates {
+		file, _ := vendorPath(tmp, template)
+		if err := writeFile(file, []byte(texts[template])); err != nil {
+			return err
+		}
+	}
+	return replaceDir(tmp, dir)
+}
@@ -0,0 +1,188 @@
+package wrapgen
+
+import (
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	nested := filepath.Join(dir, "a", "b")
+	if err := os.MkdirAll(nested, 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "a", "go.mod"), []byte("module a\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	path, err := FindLock(nested)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if expected := filepath.Join(dir, "a", LockFileName); path != expected {
+		t.Fatalf("expected %s but got %s", expected, path)
+	}
+}
+
+func TestLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, LockFileName)
+	lock, err := ReadLock(path)
+	if err != nil {
+		t.Fatalf("failed to read a missing lock: %v", err)
+	}
+	for _, template := range []string{"t.txt", "file:///t.txt", "builtin:logtime", StdinPath} {
+		if err := lock.verify(template, "i am template"); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := lock.Write(); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatal("lock recorded templates that are not remote")
+	}
+
+	if err := lock.verify("https://example.com/b.txt", "i am template"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := lock.verify("https://example.com/a.txt", "i am another template"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := lock.Write(); err != nil {
+		t.Fatal(err.Error())
+	}
+	assertContent(t, path, fmt.Sprintf(
+		"https://example.com/a.txt sha256:%x\nhttps://example.com/b.txt sha256:%x\n",
+		sha256.Sum256([]byte("i am another template")),
+		sha256.Sum256([]byte("i am template")),
+	))
+
+	lock, err = ReadLock(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := lock.verify("https://example.com/b.txt", "i am template"); err != nil {
+		t.Fatalf("lock rejected a matching template: %v", err)
+	}
+	if err := lock.verify("https://example.com/b.txt", "i am a changed template"); err == nil {
+		t.Fatal("lock accepted a changed template")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("https://example.com/a.txt sha256:abc\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if _, err := ReadLock(path); err == nil {
+		t.Fatal("read a lock with an invalid sha256")
+	}
+}
+
+func TestVerifySHA256(t *testing.T) {
+	sum := fmt.Sprintf("%x", sha256.Sum256([]byte("i am template")))
+	for _, expected := range []string{sum, "sha256:" + sum} {
+		if err := verifySHA256("t.txt", "i am template", expected); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := verifySHA256("t.txt", "i am a changed template", sum); err == nil {
+		t.Fatal("accepted a changed template")
+	}
+	if err := verifySHA256("t.txt", "i am template", "abc"); err == nil {
+		t.Fatal("accepted an invalid sha256")
+	}
+}
+
+func TestVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	ctx := context.Background()
+	remote := map[string]string{
+		"https://example.com/templates/t.txt":   "i am template",
+		"http://example.com/templates/t.txt":    "i am an insecure template",
+		"http://localhost:8080/../../etc/t.txt": "i am another template",
+	}
+	fetcher := fetcherFunc(func(ctx context.Context, path string) (string, error) {
+		text, ok := remote[path]
+		if !ok {
+			return "", fmt.Errorf("no template %s", path)
+		}
+		return text, nil
+	})
+	lock, err := ReadLock(filepath.Join(dir, LockFileName))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	for template, text := range remote {
+		if err := lock.verify(template, text); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+
+	vendored := filepath.Join(dir, VendorDirName)
+	if err := os.MkdirAll(filepath.Join(vendored, "stale"), 0755); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := Vendor(ctx, fetcher, lock, vendored); err != nil {
+		t.Fatal(err.Error())
+	}
+	assertContent(t, filepath.Join(vendored, "https", "example.com", "templates", "t.txt"), "i am template")
+	assertContent(t, filepath.Join(vendored, "http", "example.com", "templates", "t.txt"), "i am an insecure template")
+	assertContent(t, filepath.Join(vendored, "http", "localhost_8080", "etc", "t.txt"), "i am another template")
+	if _, err := os.Stat(filepath.Join(vendored, "stale")); !os.IsNotExist(err) {
+		t.Fatal("vendor kept a stale file")
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(entries) != 1 || entries[0].Name() != VendorDirName {
+		t.Fatalf("vendor left temporary files in %s: %v", dir, entries)
+	}
+
+	local := &VendoredTemplateFetcher{Dir: vendored, Fetcher: fetcherFunc(func(ctx context.Context, path string) (string, error) {
+		return "i am not vendored", nil
+	})}
+	for path, expected := range map[string]string{
+		"https://example.com/templates/t.txt": "i am template",
+		"http://example.com/templates/t.txt":  "i am an insecure template",
+		"https://example.com/templates/u.txt": "i am not vendored",
+	} {
+		text, err := local.FetchTemplate(ctx, path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if text != expected {
+			t.Fatalf("fetched wrong template for %s: %s", path, text)
+		}
+	}
+
+	remote["https://example.com/templates/t.txt"] = "i am a changed template"
+	if err := Vendor(ctx, fetcher, lock, vendored); err == nil {
+		t.Fatal("vendored a changed template")
+	}
+	assertContent(t, filepath.Join(vendored, "https", "example.com", "templates", "t.txt"), "i am template")
+}
+
+type fetcherFunc func(ctx context.Context, path string) (string, error)
+
+func (f fetcherFunc) FetchTemplate(ctx context.Context, path string) (string, error) {
+	return f(ctx, path)
+}
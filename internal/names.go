@@ -0,0 +1,255 @@
+package wrapgen
+
+import (
+	"fmt"
+	"go/token"
+	"go/types"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// scope tracks the identifiers in use at one level of a generated file. The
+// scopes form a tree where the root holds package level names, such as
+// imports, and each child holds the names of a single method.
+type scope struct {
+	parent   *scope
+	children []*scope
+	used     map[string]bool
+	fresh    map[string]string
+}
+
+func newScope(parent *scope, names ...string) *scope {
+	s := &scope{
+		parent: parent,
+		used:   make(map[string]bool),
+		fresh:  make(map[string]string),
+	}
+	if parent != nil {
+		parent.children = append(parent.children, s)
+	}
+	s.reserve(names...)
+	return s
+}
+
+func (s *scope) reserve(names ...string) {
+	for _, name := range names {
+		if name != "" && name != "_" {
+			s.used[name] = true
+		}
+	}
+}
+
+// taken reports whether a name would collide with an existing name if it were
+// declared in this scope. A name is taken if it is used in this scope, in any
+// enclosing scope where the new name would shadow it, or in any nested scope
+// where it would shadow the new name.
+func (s *scope) taken(name string) bool {
+	if token.IsKeyword(name) || types.Universe.Lookup(name) != nil {
+		return true
+	}
+	for p := s; p != nil; p = p.parent {
+		if p.used[name] {
+			return true
+		}
+	}
+	return s.takenBelow(name)
+}
+
+func (s *scope) takenBelow(name string) bool {
+	for _, child := range s.children {
+		if child.used[name] || child.takenBelow(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Fresh returns an identifier based on name that is not taken in the scope.
+// The result for any given name is stable so that a template may call Fresh
+// once to declare an identifier and again to reference it.
+func (s *scope) Fresh(name string) string {
+	if result, ok := s.fresh[name]; ok {
+		return result
+	}
+	result := s.declare(name)
+	s.fresh[name] = result
+	return result
+}
+
+// declare reserves and returns a new identifier based on name that is not
+// taken in the scope. Unlike Fresh, every call produces a new identifier.
+func (s *scope) declare(name string) string {
+	result := name
+	for x := 1; s.taken(result); x = x + 1 {
+		result = fmt.Sprintf("%s%d", name, x)
+	}
+	s.used[result] = true
+	return result
+}
+
+// Fresh generates a local identifier for use in a template. The target must
+// be either a *Package or a *Method. Package level identifiers avoid all
+// imported package names and every parameter and result name of every method
+// so that they are never shadowed. Method level identifiers avoid the
+// parameter and result names of the method, imported package names, and any
+// package level identifiers generated so far. For example, `fresh .Method
+// "start"` renders `start` unless the method already has a parameter with
+// that name, in which case it renders `start1`.
+func Fresh(target interface{}, name string) (string, error) {
+	switch t := target.(type) {
+	case *Package:
+		return t.scope().Fresh(name), nil
+	case *Method:
+		return t.scope().Fresh(name), nil
+	default:
+		return "", fmt.Errorf("fresh requires a *Package or *Method but got %T", target)
+	}
+}
+
+// TemplateFuncs returns the wrapgen specific functions that are installed in
+// every template in addition to the sprig library.
+func TemplateFuncs() template.FuncMap {
+	return template.FuncMap{
+		"fresh": Fresh,
+	}
+}
+
+func (p *Package) scope() *scope {
+	if p.names == nil {
+		p.names = newScope(nil)
+		for _, imp := range p.ImportsWithSource {
+			p.names.reserve(imp.Package)
+		}
+		for _, iface := range p.Interfaces {
+			for _, method := range iface.Methods {
+				method.names = newScope(p.names, method.paramNames()...)
+			}
+		}
+	}
+	return p.names
+}
+
+func (m *Method) scope() *scope {
+	if m.names == nil {
+		m.names = newScope(nil, m.paramNames()...)
+	}
+	return m.names
+}
+
+func (m *Method) paramNames() []string {
+	names := make([]string, 0, len(m.In)+len(m.Out))
+	for _, param := range m.In {
+		names = append(names, param.Name)
+	}
+	for _, param := range m.Out {
+		names = append(names, param.Name)
+	}
+	return names
+}
+
+// nameParameters assigns a name to every parameter and result of the method
+// that does not have one. Names are derived from the type of the parameter
+// and are unique within the method. They never collide with Go keywords,
+// predeclared identifiers, or the reserved names, such as those of imports and
+// package level types. When legacy is set the names are paramN and resultN
+// instead.
+func nameParameters(m *Method, reserved []string, legacy bool) {
+	if legacy {
+		for offset, param := range m.In {
+			if param.Name == "" {
+				param.Name = fmt.Sprintf("param%d", offset)
+			}
+		}
+		for offset, param := range m.Out {
+			if param.Name == "" {
+				param.Name = fmt.Sprintf("result%d", offset)
+			}
+		}
+		return
+	}
+	s := newScope(nil, m.paramNames()...)
+	s.reserve(reserved...)
+	for _, param := range append(append([]*Parameter{}, m.In...), m.Out...) {
+		if param.Name == "" {
+			param.Name = s.declare(typeName(param.Type))
+		}
+	}
+}
+
+// typeName suggests a variable name for a value of the given type.
+func typeName(t Type) string {
+	switch tt := t.(type) {
+	case TypeBuiltin:
+		switch {
+		case tt == "error":
+			return "err"
+		case tt == "string":
+			return "s"
+		case tt == "bool" || tt == "byte":
+			return "b"
+		case tt == "rune":
+			return "r"
+		case strings.HasPrefix(string(tt), "int") || strings.HasPrefix(string(tt), "uint"):
+			return "n"
+		case strings.HasPrefix(string(tt), "float"):
+			return "f"
+		case strings.HasPrefix(string(tt), "complex"):
+			return "c"
+		case tt == "interface{}" || tt == "struct{}":
+			return "v"
+		}
+		return lowerCamel(string(tt))
+	case *TypeExported:
+		name := tt.Type.String()
+		switch tt.Package + "." + name {
+		case "context.Context":
+			return "ctx"
+		case "io.Reader":
+			return "r"
+		case "io.Writer":
+			return "w"
+		}
+		return lowerCamel(name)
+	case *TypePointer:
+		return typeName(tt.Type)
+	case *TypeVariadic:
+		return "args"
+	case *TypeArray:
+		if tt.Type == TypeBuiltin("byte") {
+			return "data"
+		}
+		if elem := typeName(tt.Type); len(elem) > 1 {
+			return elem + "s"
+		}
+		return "values"
+	case *TypeMap:
+		return "m"
+	case *TypeChan:
+		return "ch"
+	case *TypeFunc:
+		return "fn"
+	}
+	return "v"
+}
+
+// lowerCamel converts an exported identifier into an unexported one while
+// keeping initialisms intact. For example, ExportedStruct becomes
+// exportedStruct, URL becomes url, and HTTPClient becomes httpClient.
+func lowerCamel(name string) string {
+	runes := []rune(name)
+	upper := 0
+	for upper < len(runes) && unicode.IsUpper(runes[upper]) {
+		upper = upper + 1
+	}
+	switch {
+	case upper == 0:
+		return name
+	case upper == len(runes):
+		return strings.ToLower(name)
+	case upper > 1:
+		// The last upper case rune of a run begins the next word.
+		upper = upper - 1
+	}
+	return strings.ToLower(string(runes[:upper])) + string(runes[upper:])
+}
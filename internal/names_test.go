@@ -0,0 +1,135 @@
+package wrapgen
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestScopeFresh(t *testing.T) {
+	root := newScope(nil, "io")
+	first := newScope(root, "start", "w")
+	second := newScope(root, "w")
+
+	var cases = []struct {
+		name     string
+		scope    *scope
+		base     string
+		expected string
+	}{
+		{"unused", first, "x", "x"},
+		{"stable", first, "x", "x"},
+		{"local collision", first, "start", "start1"},
+		{"parent collision", second, "io", "io1"},
+		{"child collision", root, "w", "w1"},
+		{"sibling is free", second, "start", "start"},
+		{"keyword", first, "type", "type1"},
+		{"predeclared", first, "len", "len1"},
+		{"previous fresh name", root, "x", "x1"},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			var result = tcase.scope.Fresh(tcase.base)
+			if result != tcase.expected {
+				t.Errorf("expected '%s' but got '%s'", tcase.expected, result)
+			}
+		})
+	}
+}
+
+func TestFresh(t *testing.T) {
+	ctx := context.Background()
+	pkg, err := LoadPackage(ctx, "./test/happy", Destination{}, []string{"CollidingInterface"}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	method := pkg.Interfaces[0].Methods[0]
+
+	if name, _ := Fresh(pkg, "time"); name != "time1" {
+		t.Fatalf("package name shadowed by a parameter: %s", name)
+	}
+	if name, _ := Fresh(pkg, "log"); name != "log1" {
+		t.Fatalf("package name shadowed by a result: %s", name)
+	}
+	if name, _ := Fresh(method, "start"); name != "start1" {
+		t.Fatalf("method name collided with a parameter: %s", name)
+	}
+	if name, _ := Fresh(method, "io"); name != "io1" {
+		t.Fatalf("method name shadowed an import: %s", name)
+	}
+	if name, _ := Fresh(method, "time1"); name != "time11" {
+		t.Fatalf("method name shadowed a package level name: %s", name)
+	}
+	if _, err := Fresh(pkg.Interfaces[0], "x"); err == nil {
+		t.Fatal("fresh accepted an unsupported target")
+	}
+}
+
+func TestNameParameters(t *testing.T) {
+	ctx := context.Background()
+	names := []string{"UnnamedInterface"}
+
+	pkg, err := LoadPackage(ctx, "./test/happy", Destination{}, names, LoadOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	methods := pkg.Interfaces[0].Methods
+	expected := "ctx r s s1 exportedStruct flagSet args n b err"
+	if result := strings.Join(methods[0].paramNames(), " "); result != expected {
+		t.Fatalf("expected '%s' but got '%s'", expected, result)
+	}
+	expected = "data m io"
+	if result := strings.Join(methods[1].paramNames(), " "); result != expected {
+		t.Fatalf("expected '%s' but got '%s'", expected, result)
+	}
+
+	// Parameters named after a type of the same package would shadow it.
+	pkg, err = LoadPackage(ctx, "./test/happy", Destination{}, []string{"ExportedInterfaceWithUnexportedMethod"}, LoadOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	found := false
+	for _, method := range pkg.Interfaces[0].Methods {
+		if method.Name != "B" {
+			continue
+		}
+		found = true
+		expected = "unexportedStruct1 unexportedStruct2"
+		if result := strings.Join(method.paramNames(), " "); result != expected {
+			t.Fatalf("expected '%s' but got '%s'", expected, result)
+		}
+	}
+	if !found {
+		t.Fatal("method B was not loaded")
+	}
+
+	pkg, err = LoadPackage(ctx, "./test/happy", Destination{}, names, LoadOptions{LegacyNames: true})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	methods = pkg.Interfaces[0].Methods
+	expected = "param0 param1 param2 param3 param4 param5 param6 result0 result1 result2"
+	if result := strings.Join(methods[0].paramNames(), " "); result != expected {
+		t.Fatalf("expected '%s' but got '%s'", expected, result)
+	}
+}
+
+func TestLowerCamel(t *testing.T) {
+	var cases = []struct {
+		name     string
+		expected string
+	}{
+		{"ExportedStruct", "exportedStruct"},
+		{"URL", "url"},
+		{"HTTPClient", "httpClient"},
+		{"local", "local"},
+	}
+	for _, tcase := range cases {
+		t.Run(tcase.name, func(t *testing.T) {
+			var result = lowerCamel(tcase.name)
+			if result != tcase.expected {
+				t.Errorf("expected '%s' but got '%s'", tcase.expected, result)
+			}
+		})
+	}
+}
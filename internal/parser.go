@@ -5,7 +5,9 @@ import (
 	"fmt"
 	"go/ast"
 	"go/token"
-	"strconv"
+	"go/types"
+	"path/filepath"
+	"sort"
 	"strings"
 
 	"golang.org/x/tools/go/packages"
@@ -15,107 +17,224 @@ const (
 	sourceAlias = "srcPkgAlias"
 )
 
-func loadPackage(ctx context.Context, path string) (*packages.Package, error) {
-	fset := token.NewFileSet()
-	conf := &packages.Config{
-		Mode:    packages.LoadAllSyntax,
+// loadMode is the minimum detail needed to interpret a package. Only the
+// requested package is parsed and type checked from source. The types of its
+// dependencies are read from compiler export data which avoids parsing and
+// type checking the source of every transitive dependency.
+const loadMode = packages.NeedName |
+	packages.NeedFiles |
+	packages.NeedTypes |
+	packages.NeedSyntax |
+	packages.NeedTypesInfo
+
+// loadPackages loads every given package pattern with a single call to
+// packages.Load. Relative patterns are interpreted from dir, or from the
+// working directory if dir is empty. The result maps each pattern to the
+// matching package. Patterns that fail to load, or that do not match exactly
+// one package, are mapped to an error instead.
+func loadPackages(ctx context.Context, dir string, patterns ...string) (map[string]*packages.Package, map[string]error) {
+	pkgs, err := packages.Load(newLoadConfig(ctx, dir), patterns...)
+	results := make(map[string]*packages.Package, len(patterns))
+	errs := make(map[string]error)
+	if err != nil {
+		for _, pattern := range patterns {
+			errs[pattern] = err
+		}
+		return results, errs
+	}
+	for _, pattern := range patterns {
+		pkg := matchPackage(dir, pattern, pkgs)
+		if pkg == nil {
+			// The pattern is reloaded on its own so that any error is
+			// attributed to the correct pattern.
+			pkg, err = loadPackage(ctx, dir, pattern)
+			if err != nil {
+				errs[pattern] = err
+				continue
+			}
+		}
+		if err := packageErrors(pkg); err != nil {
+			errs[pattern] = err
+			continue
+		}
+		results[pattern] = pkg
+	}
+	return results, errs
+}
+
+func newLoadConfig(ctx context.Context, dir string) *packages.Config {
+	return &packages.Config{
+		Mode:    loadMode,
 		Context: ctx,
-		Fset:    fset,
+		Dir:     dir,
+		Fset:    token.NewFileSet(),
+	}
+}
+
+// matchPackage finds the package loaded for a pattern. Import paths match the
+// package path and file system paths match the directory of the package.
+func matchPackage(dir string, pattern string, pkgs []*packages.Package) *packages.Package {
+	if !isFilePattern(pattern) {
+		for _, pkg := range pkgs {
+			if pkg.PkgPath == pattern {
+				return pkg
+			}
+		}
+		return nil
 	}
-	pkgs, err := packages.Load(conf, path)
+	path := pattern
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return nil
+	}
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) > 0 && filepath.Dir(pkg.GoFiles[0]) == path {
+			return pkg
+		}
+	}
+	return nil
+}
+
+func isFilePattern(pattern string) bool {
+	return filepath.IsAbs(pattern) || pattern == "." || pattern == ".." ||
+		strings.HasPrefix(pattern, "./") || strings.HasPrefix(pattern, "../")
+}
+
+func loadPackage(ctx context.Context, dir string, path string) (*packages.Package, error) {
+	pkgs, err := packages.Load(newLoadConfig(ctx, dir), path)
 	if err != nil {
 		return nil, err
 	}
 	if len(pkgs) < 1 {
-		return nil, fmt.Errorf("%s not found\n", path)
+		return nil, fmt.Errorf("%s not found", path)
 	}
-	if len(pkgs) > 2 {
+	if len(pkgs) > 1 {
 		return nil, fmt.Errorf(
-			"%s contains too many packages. expected at most 2 (pkg, pkg_test). found: %s\n",
+			"%s contains too many packages. expected 1. found: %s",
 			path, pkgs,
 		)
 	}
+	return pkgs[0], packageErrors(pkgs[0])
+}
+
+func packageErrors(pkg *packages.Package) error {
 	var pkgErrors []error
-	for _, pkg := range pkgs {
-		for _, pkgErr := range pkg.Errors {
-			// []packages.Error cannot conver to []error even though all the
-			// contained types are valid error implementations. Because of this
-			// we must individually iterate and append rather than using append
-			// with the variadic notation (ex: append(x, y...)).
-			pkgErrors = append(pkgErrors, pkgErr)
-		}
+	for _, pkgErr := range pkg.Errors {
+		// []packages.Error cannot conver to []error even though all the
+		// contained types are valid error implementations. Because of this
+		// we must individually iterate and append rather than using append
+		// with the variadic notation (ex: append(x, y...)).
+		pkgErrors = append(pkgErrors, pkgErr)
 	}
 	if len(pkgErrors) > 0 {
-		return nil, multiError(pkgErrors)
-	}
-	var pkg *packages.Package
-	for _, p := range pkgs {
-		if strings.Contains(p.Name, "_test") {
-			continue
-		}
-		pkg = p
-	}
-	if pkg == nil {
-		return nil, fmt.Errorf("%s only contains test packages", path)
+		return multiError(pkgErrors)
 	}
-	return pkg, nil
+	return nil
+}
+
+// LoadOptions adjust how LoadPackage interprets a package.
+type LoadOptions struct {
+	// LegacyNames names unnamed parameters and results by their position,
+	// such as param0 and result0, rather than by their type.
+	LegacyNames bool
 }
 
-func LoadPackage(ctx context.Context, srcPkg string, dstPkg string, names []string) (*Package, error) {
-	pkg, err := loadPackage(ctx, srcPkg)
+// LoadPackage loads a source package and interprets the named interfaces for
+// rendering into the destination package.
+func LoadPackage(ctx context.Context, srcPkg string, dst Destination, names []string, opts LoadOptions) (*Package, error) {
+	pkg, err := loadPackage(ctx, "", srcPkg)
 	if err != nil {
 		return nil, fmt.Errorf("failed to load package data: %v", err)
 	}
-	var srcPkgAlias string
-	if dstPkg != "" {
-		srcPkgAlias = sourceAlias
+	return newPackage(ctx, pkg, dst, names, opts)
+}
+
+func newPackage(ctx context.Context, pkg *packages.Package, dst Destination, names []string, opts LoadOptions) (*Package, error) {
+	imports, interfaces, err := LoadInterfaces(ctx, pkg, names)
+	if err != nil {
+		return nil, err
 	}
-	imports, interfaces, err := LoadInterfaces(ctx, srcPkg, srcPkgAlias, names)
+	dst, err = resolveDestination(ctx, dst, pkg)
 	if err != nil {
 		return nil, err
 	}
-	imports = filterUniqueImports(imports)
+	source := &Import{
+		Package: pkg.Name,
+		Path:    pkg.PkgPath,
+	}
+	if err := checkExportable(dst, interfaces); err != nil {
+		return nil, err
+	}
+	imports, sourceName := qualify(dst, source, filterUniqueImports(imports), interfaces)
 	result := &Package{
-		Name: dstPkg,
-		Source: &Import{
-			Package: pkg.Name,
-			Path:    pkg.PkgPath,
-		},
+		Name:              dst.Name,
+		Source:            source,
 		Interfaces:        interfaces,
 		Imports:           imports,
 		ImportsWithSource: append([]*Import{}, imports...),
 	}
-	if dstPkg != "" {
+	if dst.Path != source.Path {
 		importsContainSource := false
 		for _, imp := range result.Imports {
-			if imp.Path == pkg.PkgPath {
+			if imp.Path == source.Path {
 				importsContainSource = true
 			}
 		}
 		if !importsContainSource {
 			result.ImportsWithSource = append(result.ImportsWithSource, &Import{
-				Package: sourceAlias,
-				Path:    pkg.PkgPath,
+				Package: sourceName,
+				Path:    source.Path,
 			})
 		}
 	}
-	if result.Name == "" {
-		result.Name = pkg.Name
+	// Parameters must not shadow the imports or, when the output is in the
+	// source package, the types that the method refers to without a
+	// qualifier.
+	var reserved []string
+	for _, imp := range result.ImportsWithSource {
+		reserved = append(reserved, imp.Package)
 	}
+	if dst.Path == source.Path {
+		reserved = append(reserved, typeNames(pkg)...)
+	}
+	for _, iface := range result.Interfaces {
+		for _, method := range iface.Methods {
+			nameParameters(method, reserved, opts.LegacyNames)
+		}
+	}
+	// Build the identifier scopes now so that method level scopes are linked
+	// to the package level scope regardless of the order in which a template
+	// asks for fresh names.
+	_ = result.scope()
 	return result, nil
 }
 
-func LoadInterfaces(ctx context.Context, srcPkg, srcPkgAlias string, names []string) ([]*Import, []*Interface, error) {
-	pkg, err := loadPackage(ctx, srcPkg)
-	if err != nil {
-		return nil, nil, fmt.Errorf("failed to load package data: %v", err)
+// typeNames returns the names of the package level types of a package.
+func typeNames(pkg *packages.Package) []string {
+	if pkg.Types == nil {
+		return nil
+	}
+	var names []string
+	scope := pkg.Types.Scope()
+	for _, name := range scope.Names() {
+		if _, ok := scope.Lookup(name).(*types.TypeName); ok {
+			names = append(names, name)
+		}
 	}
+	return names
+}
+
+// LoadInterfaces interprets the named interfaces of a loaded package.
+func LoadInterfaces(ctx context.Context, pkg *packages.Package, names []string) ([]*Import, []*Interface, error) {
 	var (
 		imports []*Import
 		ifaces  []*Interface
 	)
 	for _, name := range names {
-		imps, iface, err := loadInterface(ctx, pkg, name, srcPkgAlias)
+		imps, iface, err := loadInterface(pkg, name)
 		if err != nil {
 			return nil, nil, err
 		}
@@ -125,241 +244,264 @@ func LoadInterfaces(ctx context.Context, srcPkg, srcPkgAlias string, names []str
 	return imports, ifaces, nil
 }
 
-func loadInterface(ctx context.Context, pkg *packages.Package, name, srcPkgAlias string) ([]*Import, *Interface, error) {
-	for _, f := range pkg.Syntax {
-		localImport := locals(ctx, pkg, f)
-		if srcPkgAlias != "" {
-			localImport[pkg.PkgPath] = srcPkgAlias
-		}
+// typeSpecs calls fn with every type declared in the given files, along with
+// the declaration that contains it, until fn returns false.
+func typeSpecs(files []*ast.File, fn func(*ast.GenDecl, *ast.TypeSpec) bool) {
+	for _, f := range files {
 		for _, decl := range f.Decls {
-			switch dd := decl.(type) {
-			case *ast.GenDecl:
-				// https://golang.org/pkg/go/ast/#GenDecl
-				// For ease of understanding, here are some details from the
-				// official documentation linked above:
-				//
-				// A GenDecl node (generic declaration node) represents an import,
-				// constant, type or variable declaration.
-				// Relationship between Tok value and Specs element type:
-				// token.IMPORT  *ImportSpec
-				// token.CONST   *ValueSpec
-				// token.TYPE    *TypeSpec
-				// token.VAR     *ValueSpec
-				//
-				// Because of the relationship between the token type and the
-				// underlying spec value, we are able to perform a comparison check
-				// here which prevents the need to do more type switching on the
-				// spec value.
-				if dd.Tok != token.TYPE {
-					// Full list of token types can be found here:
-					// https://golang.org/pkg/go/token/#Token.
-					continue
-				}
-				for _, spec := range dd.Specs {
-					ss, ok := spec.(*ast.TypeSpec)
-					if !ok {
-						continue
-					}
-					if ss.Name == nil || ss.Name.Name != name {
-						continue
-					}
-					// https://golang.org/pkg/go/ast/#TypeSpec
-					// TypeSpec instances represent anywhere a new type is defined.
-					// TypeSpecs are categorized by their own SrcType field which
-					// indicates the kind of type definition. The possible values
-					// from the docs are:
-					//
-					// - *Ident
-					// - *ParenExpr
-					// - *SelectorExpr
-					// - *StarExpr
-					// - any of the *XxxTypes
-					//
-					// The "any of the *XxxTypes" refers to other concrete elements
-					// from the ast modules such as ArrayType or ChanType. Since
-					// this project is scoped only to handling interface types we
-					// can safely ignore all of the concrete types as they are not
-					// relevant. The *StarExpr is also ignored because cases of a
-					// a pointer to an interface (ex: `type T *io.Writer`) don't
-					// really make sense as the pointer has no methods to capture.
-					//
-					// Each relevant case is captured and documented in the switch
-					// below.
-					switch ff := ss.Type.(type) {
-					case *ast.InterfaceType:
-						// InterfaceType is an easy case where something has been
-						// defined as `type T interface{}`. This is the clearest
-						// and easiest to handle case.
-						return parseInterface(ctx, pkg, localImport, ss.Name.String(), srcPkgAlias, ff)
-					case *ast.ParenExpr:
-						// It's not clear from the docs exactly how a ParenExpr
-						// might appear as a TypeSpec category. Placing this error
-						// here in the hopes that whoever finds this case will open
-						// an issue so we can implement it correctly using their
-						// use case as a guide.
-						return nil, nil, fmt.Errorf(
-							"unhandled ParenExpr for type %s. please report this issue",
-							ss.Name,
-						)
-					case *ast.Ident:
-						// https://golang.org/pkg/go/ast/#Ident
-						// Ident covers cases of aliases and subtypes where
-						// there is no use of the `.` character on the right-hand
-						// side.
-						if ff.Obj == nil {
-							// According to the docs, the Ident ast node has an optional
-							// `Obj` field which may be either `nil` or a reference to
-							// the entity referenced. This presents a challenge for
-							// cases where the `Obj` is `nil` because we have no
-							// reliable way of determining how to get the data we need.
-							// For now, we will emit an error for this case and decide
-							// later if we can support it or not.
-							return nil, nil, fmt.Errorf(
-								"unhandled missing Obj in Ident for type %s. please report this issue",
-								ss.Name,
-							)
-						}
-						if ff.Obj.Kind != ast.Typ {
-							// https://golang.org/pkg/go/ast/#ObjKind
-							// The only object kind we support is Typ as that is
-							// the only kind that may be an interface.
-							continue
-						}
-						// For all cases found so far, an Obj kind of Typ contains
-						// a non-nil Decl reference to either the TypeSpec of
-						// the type being aliased/extended or the SelectorExpr
-						// of a remote type being reference..
-						switch fft := ff.Obj.Decl.(*ast.TypeSpec).Type.(type) {
-						case *ast.InterfaceType:
-							return parseInterface(ctx, pkg, localImport, ss.Name.String(), srcPkgAlias, fft)
-						case *ast.SelectorExpr:
-							// This is a curious case where the right-hand side
-							// may actually resolve to a SelectorExpr when the
-							// value is the name of a local alias that _was_
-							// defined with a SelectorExpr. For example:
-							//
-							// type T io.Writer
-							// type T2 T
-							//
-							// The handling logic is exactly the same as if the
-							// SelectorExpr case of the TypeSpec switch. The
-							// explanation is documented in more detail there.
-							if _, ok := fft.X.(*ast.Ident); !ok {
-								return nil, nil, fmt.Errorf(
-									"cannot interpret %s in %s. expression too complex",
-									name, pkg.PkgPath,
-								)
-							}
-							remotePkgName := fft.X.(*ast.Ident).Name
-							remoteItemName := fft.Sel.Name
-							remotePkgName = localImport[remotePkgName]
-							remotePkg := pkg.Imports[remotePkgName]
-							var u, ifs, err = loadInterface(ctx, remotePkg, remoteItemName, srcPkgAlias)
-							if err != nil {
-								return nil, nil, err
-							}
-							ifs.Name = name
-							return append(u, &Import{Path: remotePkg.PkgPath, Package: remotePkg.Name}), ifs, nil
-						default:
-							return nil, nil, fmt.Errorf(
-								"%s in %s is not an interface", name, pkg.PkgPath,
-							)
-						}
-					case *ast.SelectorExpr:
-						// https://golang.org/pkg/go/ast/#SelectorExpr
-						// SelectorExpr represents a case of defining an alias or
-						// subtype for a type from a different package. This node
-						// has two attributes, X and Sel. The X attribute can be
-						// any kind of expression and the Sel attribute is an
-						// Identity node that represents what comes after the `.`
-						// character. For example, some valid selector expressions
-						// might be:
-						//
-						// - t.(T).Attribute
-						// - t.Method
-						// - pkg.T
-						//
-						// Each of these might resolve to a different expression
-						// type for X. In the context of type definitions, the only
-						// case we cover is when X is an Identity node denoting the
-						// package name (ex: `type T pkg.T`).
-						if _, ok := ff.X.(*ast.Ident); !ok {
-							return nil, nil, fmt.Errorf(
-								"cannot interpret %s in %s. expression too complex",
-								name, pkg.PkgPath,
-							)
-						}
-						remotePkgName := ff.X.(*ast.Ident).Name
-						remoteItemName := ff.Sel.Name
-						// Unfortunately, unlike the Ident case in this switch, we
-						// are always given `nil` for both the X and Sel values of
-						// Obj which means we are now responsible for finding the
-						// relevant content. This is the reason we need access to
-						// the global map of package data. To do this we must first
-						// convert the local selector name into a full package path.
-						// We do this because the remote package may be aliased as
-						// any arbitrary name within the current file. Other files
-						// in the same package may also use that same alias name but
-						// for a different imported package. The result is that we
-						// have to track the file-local names of imports and convert
-						// them where we encounter them.
-						remotePkgName = localImport[remotePkgName]
-						remotePkg := pkg.Imports[remotePkgName]
-						var u, ifs, err = loadInterface(ctx, remotePkg, remoteItemName, srcPkgAlias)
-						if err != nil {
-							return nil, nil, err
-						}
-						ifs.Name = name
-						return append(u, &Import{Path: remotePkg.PkgPath, Package: remotePkg.Name}), ifs, nil
-					default:
-						return nil, nil, fmt.Errorf(
-							"%s in %s is not an interface.", name, pkg.PkgPath,
-						)
-					}
-				}
-			default:
+			dd, ok := decl.(*ast.GenDecl)
+			if !ok {
 				// Since all type definitions match GenDecl we can safely ignore
 				// everything else.
 				continue
 			}
+			// https://golang.org/pkg/go/ast/#GenDecl
+			// For ease of understanding, here are some details from the
+			// official documentation linked above:
+			//
+			// A GenDecl node (generic declaration node) represents an import,
+			// constant, type or variable declaration.
+			// Relationship between Tok value and Specs element type:
+			// token.IMPORT  *ImportSpec
+			// token.CONST   *ValueSpec
+			// token.TYPE    *TypeSpec
+			// token.VAR     *ValueSpec
+			//
+			// Because of the relationship between the token type and the
+			// underlying spec value, we are able to perform a comparison check
+			// here which prevents the need to do more type switching on the
+			// spec value.
+			if dd.Tok != token.TYPE {
+				// Full list of token types can be found here:
+				// https://golang.org/pkg/go/token/#Token.
+				continue
+			}
+			for _, spec := range dd.Specs {
+				ss, ok := spec.(*ast.TypeSpec)
+				if !ok {
+					continue
+				}
+				if !fn(dd, ss) {
+					return
+				}
+			}
 		}
 	}
-	return nil, nil, fmt.Errorf("interface %s not found in package %s", name, pkg.PkgPath)
 }
 
-func parseType(ctx context.Context, pkg *packages.Package, locals map[string]string, arg ast.Expr) ([]*Import, Type, error) {
-	switch n := arg.(type) {
-	case *ast.ArrayType:
-		var len = -1
-		if n.Len != nil {
-			len, _ = strconv.Atoi(n.Len.(*ast.BasicLit).Value)
+func loadInterface(pkg *packages.Package, name string) ([]*Import, *Interface, error) {
+	var ss *ast.TypeSpec
+	typeSpecs(pkg.Syntax, func(_ *ast.GenDecl, spec *ast.TypeSpec) bool {
+		if spec.Name != nil && spec.Name.Name == name {
+			ss = spec
+			return false
+		}
+		return true
+	})
+	if ss == nil {
+		return nil, nil, fmt.Errorf("interface %s not found in package %s", name, pkg.PkgPath)
+	}
+	// https://golang.org/pkg/go/ast/#TypeSpec
+	// TypeSpec instances represent anywhere a new type is defined.
+	// TypeSpecs are categorized by their own SrcType field which
+	// indicates the kind of type definition. The possible values
+	// from the docs are:
+	//
+	// - *Ident
+	// - *ParenExpr
+	// - *SelectorExpr
+	// - *StarExpr
+	// - any of the *XxxTypes
+	//
+	// The "any of the *XxxTypes" refers to other concrete elements
+	// from the ast modules such as ArrayType or ChanType. Since
+	// this project is scoped only to handling interface types we
+	// can safely ignore all of the concrete types as they are not
+	// relevant. The *StarExpr is also ignored because cases of a
+	// a pointer to an interface (ex: `type T *io.Writer`) don't
+	// really make sense as the pointer has no methods to capture.
+	//
+	// Each relevant case is captured and documented in the switch
+	// below.
+	switch ff := ss.Type.(type) {
+	case *ast.InterfaceType:
+		// InterfaceType is an easy case where something has been
+		// defined as `type T interface{}`. This is the clearest
+		// and easiest to handle case.
+		return parseInterface(pkg, ss.Name.String(), ff)
+	case *ast.ParenExpr:
+		// It's not clear from the docs exactly how a ParenExpr
+		// might appear as a TypeSpec category. Placing this error
+		// here in the hopes that whoever finds this case will open
+		// an issue so we can implement it correctly using their
+		// use case as a guide.
+		return nil, nil, fmt.Errorf(
+			"unhandled ParenExpr for type %s. please report this issue",
+			ss.Name,
+		)
+	case *ast.Ident:
+		// https://golang.org/pkg/go/ast/#Ident
+		// Ident covers cases of aliases and subtypes where
+		// there is no use of the `.` character on the right-hand
+		// side.
+		if ff.Obj == nil {
+			// According to the docs, the Ident ast node has an optional
+			// `Obj` field which may be either `nil` or a reference to
+			// the entity referenced. This presents a challenge for
+			// cases where the `Obj` is `nil` because we have no
+			// reliable way of determining how to get the data we need.
+			// For now, we will emit an error for this case and decide
+			// later if we can support it or not.
+			return nil, nil, fmt.Errorf(
+				"unhandled missing Obj in Ident for type %s. please report this issue",
+				ss.Name,
+			)
+		}
+		if ff.Obj.Kind != ast.Typ {
+			// https://golang.org/pkg/go/ast/#ObjKind
+			// The only object kind we support is Typ as that is
+			// the only kind that may be an interface.
+			return nil, nil, fmt.Errorf("%s in %s is not an interface", name, pkg.PkgPath)
 		}
-		var u, typ, e = parseType(ctx, pkg, locals, n.Elt)
+		// For all cases found so far, an Obj kind of Typ contains
+		// a non-nil Decl reference to either the TypeSpec of
+		// the type being aliased/extended or the SelectorExpr
+		// of a remote type being reference..
+		switch fft := ff.Obj.Decl.(*ast.TypeSpec).Type.(type) {
+		case *ast.InterfaceType:
+			return parseInterface(pkg, ss.Name.String(), fft)
+		case *ast.SelectorExpr:
+			// This is a curious case where the right-hand side
+			// may actually resolve to a SelectorExpr when the
+			// value is the name of a local alias that _was_
+			// defined with a SelectorExpr. For example:
+			//
+			// type T io.Writer
+			// type T2 T
+			//
+			// The handling logic is exactly the same as if the
+			// SelectorExpr case of the TypeSpec switch. The
+			// explanation is documented in more detail there.
+			if _, ok := fft.X.(*ast.Ident); !ok {
+				return nil, nil, fmt.Errorf(
+					"cannot interpret %s in %s. expression too complex",
+					name, pkg.PkgPath,
+				)
+			}
+			return parseRemoteInterface(pkg, name, fft)
+		default:
+			return nil, nil, fmt.Errorf(
+				"%s in %s is not an interface", name, pkg.PkgPath,
+			)
+		}
+	case *ast.SelectorExpr:
+		// https://golang.org/pkg/go/ast/#SelectorExpr
+		// SelectorExpr represents a case of defining an alias or
+		// subtype for a type from a different package. This node
+		// has two attributes, X and Sel. The X attribute can be
+		// any kind of expression and the Sel attribute is an
+		// Identity node that represents what comes after the `.`
+		// character. For example, some valid selector expressions
+		// might be:
+		//
+		// - t.(T).Attribute
+		// - t.Method
+		// - pkg.T
+		//
+		// Each of these might resolve to a different expression
+		// type for X. In the context of type definitions, the only
+		// case we cover is when X is an Identity node denoting the
+		// package name (ex: `type T pkg.T`).
+		if _, ok := ff.X.(*ast.Ident); !ok {
+			return nil, nil, fmt.Errorf(
+				"cannot interpret %s in %s. expression too complex",
+				name, pkg.PkgPath,
+			)
+		}
+		// Unfortunately, unlike the Ident case in this switch, we
+		// are always given `nil` for both the X and Sel values of
+		// Obj which means we are now responsible for finding the
+		// relevant content. The remote package is loaded only from
+		// export data and has no syntax to walk so the interface
+		// is read from the type information instead.
+		return parseRemoteInterface(pkg, name, ff)
+	default:
+		return nil, nil, fmt.Errorf(
+			"%s in %s is not an interface.", name, pkg.PkgPath,
+		)
+	}
+}
+
+func parseType(pkg *packages.Package, arg ast.Expr) ([]*Import, Type, error) {
+	if n, ok := arg.(*ast.Ellipsis); ok {
+		// The type checker records the slice type of a variadic parameter
+		// rather than the ellipsis so it is unwrapped here.
+		var u, t, e = parseType(pkg, n.Elt)
 		if e != nil {
 			return nil, nil, e
 		}
-		return u, &TypeArray{Len: len, Type: typ}, nil
-	case *ast.ChanType:
-		var u, t, e = parseType(ctx, pkg, locals, n.Value)
+		return u, &TypeVariadic{Type: t}, nil
+	}
+	var t = pkg.TypesInfo.TypeOf(arg)
+	if t == nil {
+		return nil, nil, fmt.Errorf("unknown type at %v", pkg.Fset.Position(arg.Pos()))
+	}
+	var u, result, e = convertType(t)
+	if e != nil {
+		return nil, nil, fmt.Errorf("%v: %v", pkg.Fset.Position(arg.Pos()), e)
+	}
+	return u, result, nil
+}
+
+// convertType renders a type checked Go type into the equivalent Type. Any
+// package that must be imported to reference the type is also returned.
+func convertType(t types.Type) ([]*Import, Type, error) {
+	// Both named types and type aliases identify themselves with a TypeName.
+	// This is checked through an interface because types.Alias is not
+	// available in all supported versions of Go.
+	if named, ok := t.(interface{ Obj() *types.TypeName }); ok {
+		obj := named.Obj()
+		if obj.Pkg() == nil {
+			// Predeclared types, such as error, have no package.
+			return nil, TypeBuiltin(obj.Name()), nil
+		}
+		imp := &Import{Path: obj.Pkg().Path(), Package: obj.Pkg().Name()}
+		return []*Import{imp}, &TypeExported{Package: imp.Package, Path: imp.Path, Type: TypeBuiltin(obj.Name())}, nil
+	}
+	switch n := t.(type) {
+	case *types.Basic:
+		if n.Kind() == types.UnsafePointer {
+			imp := &Import{Path: "unsafe", Package: "unsafe"}
+			return []*Import{imp}, &TypeExported{Package: imp.Package, Path: imp.Path, Type: TypeBuiltin("Pointer")}, nil
+		}
+		return nil, TypeBuiltin(n.Name()), nil
+	case *types.Array:
+		var u, typ, e = convertType(n.Elem())
+		if e != nil {
+			return nil, nil, e
+		}
+		return u, &TypeArray{Len: int(n.Len()), Type: typ}, nil
+	case *types.Slice:
+		var u, typ, e = convertType(n.Elem())
 		if e != nil {
 			return nil, nil, e
 		}
-		var chanType = &TypeChan{Type: t}
-		if n.Dir == ast.SEND {
+		return u, &TypeArray{Len: -1, Type: typ}, nil
+	case *types.Chan:
+		var u, typ, e = convertType(n.Elem())
+		if e != nil {
+			return nil, nil, e
+		}
+		var chanType = &TypeChan{Type: typ}
+		if n.Dir() == types.SendOnly {
 			chanType.WriteOnly = true
 		}
-		if n.Dir == ast.RECV {
+		if n.Dir() == types.RecvOnly {
 			chanType.ReadOnly = true
 		}
 		return u, chanType, nil
-	case *ast.Ellipsis:
-		var u, t, e = parseType(ctx, pkg, locals, n.Elt)
-		if e != nil {
-			return nil, nil, e
-		}
-		return u, &TypeVariadic{Type: t}, nil
-	case *ast.FuncType:
-		var u, method, e = parseFunc(ctx, pkg, locals, "", n)
+	case *types.Signature:
+		var u, method, e = convertSignature("", n)
 		if e != nil {
 			return nil, nil, e
 		}
@@ -371,112 +513,218 @@ func parseType(ctx context.Context, pkg *packages.Package, locals map[string]str
 			result.Out = append(result.Out, param.Type)
 		}
 		return u, result, nil
-	case *ast.Ident:
-		if n.IsExported() {
-			// alias indicate we want to alias a type in this package
-			if alias := locals[pkg.PkgPath]; alias != "" {
-				return []*Import{{Path: pkg.PkgPath, Package: alias}}, &TypeExported{Package: alias, Type: TypeBuiltin(n.Name)}, nil
-			}
-			// assume type in this package
-			return nil, TypeBuiltin(n.Name), nil
-		}
-		return nil, TypeBuiltin(n.Name), nil
-	case *ast.InterfaceType:
-		if n.Methods != nil && len(n.Methods.List) > 0 {
-			return nil, nil, fmt.Errorf("can't handle non-empty unnamed interface types at %v", n.Pos())
+	case *types.Interface:
+		if n.NumMethods() > 0 || n.NumEmbeddeds() > 0 {
+			return nil, nil, fmt.Errorf("can't handle non-empty unnamed interface types")
 		}
 		return nil, TypeBuiltin("interface{}"), nil
-	case *ast.MapType:
-		var key Type
-		var uKey []*Import
-		var value Type
-		var uValue []*Import
-		var e error
-		uKey, key, e = parseType(ctx, pkg, locals, n.Key)
+	case *types.Map:
+		var uKey, key, e = convertType(n.Key())
 		if e != nil {
 			return nil, nil, e
 		}
-		uValue, value, e = parseType(ctx, pkg, locals, n.Value)
-		if e != nil {
-			return nil, nil, e
+		var uValue, value, ev = convertType(n.Elem())
+		if ev != nil {
+			return nil, nil, ev
 		}
 		return append(uKey, uValue...), &TypeMap{Key: key, Value: value}, nil
-	case *ast.SelectorExpr:
-		pkgName := n.X.(*ast.Ident).String()
-		pkgName = locals[pkgName]
-		remotePkg := pkg.Imports[pkgName]
-		return []*Import{{Path: remotePkg.PkgPath, Package: remotePkg.Name}}, &TypeExported{Package: remotePkg.Name, Type: TypeBuiltin(n.Sel.String())}, nil
-	case *ast.StarExpr:
-		var u, t, e = parseType(ctx, pkg, locals, n.X)
+	case *types.Pointer:
+		var u, typ, e = convertType(n.Elem())
 		if e != nil {
 			return nil, nil, e
 		}
-		return u, &TypePointer{Type: t}, nil
-	case *ast.StructType:
-		if n.Fields != nil && len(n.Fields.List) > 0 {
-			return nil, nil, fmt.Errorf("can't handle non-empty unnamed struct types at %v", n.Pos())
+		return u, &TypePointer{Type: typ}, nil
+	case *types.Struct:
+		if n.NumFields() > 0 {
+			return nil, nil, fmt.Errorf("can't handle non-empty unnamed struct types")
 		}
 		return nil, TypeBuiltin("struct{}"), nil
 	}
-	return nil, nil, fmt.Errorf("unknown type: %T", arg)
+	return nil, nil, fmt.Errorf("unknown type: %s", t)
+}
+
+// convertSignature is the type checked equivalent of parseFunc. It is used
+// for methods of packages that were loaded without syntax.
+func convertSignature(name string, sig *types.Signature) ([]*Import, *Method, error) {
+	var method = &Method{Name: name, In: make([]*Parameter, 0), Out: make([]*Parameter, 0)}
+	var used []*Import
+	for offset := 0; offset < sig.Params().Len(); offset = offset + 1 {
+		var v = sig.Params().At(offset)
+		var u, t, e = convertType(v.Type())
+		if e != nil {
+			return nil, nil, e
+		}
+		if slice, ok := t.(*TypeArray); ok && sig.Variadic() && offset == sig.Params().Len()-1 {
+			t = &TypeVariadic{Type: slice.Type}
+		}
+		used = append(used, u...)
+		method.In = append(method.In, &Parameter{Name: varName(v), Type: t})
+	}
+	for offset := 0; offset < sig.Results().Len(); offset = offset + 1 {
+		var v = sig.Results().At(offset)
+		var u, t, e = convertType(v.Type())
+		if e != nil {
+			return nil, nil, e
+		}
+		used = append(used, u...)
+		method.Out = append(method.Out, &Parameter{Name: varName(v), Type: t})
+	}
+	return used, method, nil
+}
+
+// varName returns the name of a parameter or an empty string if the parameter
+// is unnamed or blank.
+func varName(v *types.Var) string {
+	if v.Name() == "_" {
+		return ""
+	}
+	return v.Name()
+}
+
+// parseRemoteInterface interprets a type declaration, such as `type T pkg.I`,
+// that refers to an interface in another package.
+func parseRemoteInterface(pkg *packages.Package, name string, expr ast.Expr) ([]*Import, *Interface, error) {
+	var u, ifs, err = convertInterface(pkg, name, pkg.TypesInfo.TypeOf(expr))
+	if err != nil {
+		return nil, nil, err
+	}
+	ifs.SrcType = localType(pkg, name)
+	return u, ifs, nil
+}
+
+// convertInterface is the type checked equivalent of parseInterface. The
+// package that declares the interface is included in the returned imports.
+func convertInterface(pkg *packages.Package, name string, t types.Type) ([]*Import, *Interface, error) {
+	if t == nil {
+		return nil, nil, fmt.Errorf("unknown type for %s in %s", name, pkg.PkgPath)
+	}
+	var ifc, ok = t.Underlying().(*types.Interface)
+	if !ok {
+		return nil, nil, fmt.Errorf("%s in %s is not an interface", name, pkg.PkgPath)
+	}
+	var used, srcType, e = convertType(t)
+	if e != nil {
+		return nil, nil, e
+	}
+	var iface = &Interface{SrcType: srcType, Name: name, Methods: make([]*Method, 0)}
+	var positions []token.Position
+	for offset := 0; offset < ifc.NumMethods(); offset = offset + 1 {
+		var fn = ifc.Method(offset)
+		var u, m, e = convertSignature(fn.Name(), fn.Type().(*types.Signature))
+		if e != nil {
+			return nil, nil, e
+		}
+		if fn.Pkg() != nil {
+			m.pkgPath = fn.Pkg().Path()
+		}
+		m.pos = pkg.Fset.Position(fn.Pos())
+		used = append(used, u...)
+		iface.Methods = append(iface.Methods, m)
+		positions = append(positions, m.pos)
+	}
+	// The type checker orders methods by name. They are put back into the
+	// order of their declarations, as parseInterface gives, so that the
+	// output does not change depending on how the interface was loaded.
+	// Methods without a position keep the order of the type checker.
+	for _, pos := range positions {
+		if !pos.IsValid() {
+			return used, iface, nil
+		}
+	}
+	sort.Stable(byPosition{iface.Methods, positions})
+	return used, iface, nil
+}
+
+// byPosition sorts methods by the position of their declarations. Embedded
+// interfaces may be declared in other files, which are ordered by name, so
+// that the order does not depend on the order in which files were loaded.
+type byPosition struct {
+	methods   []*Method
+	positions []token.Position
+}
+
+func (b byPosition) Len() int {
+	return len(b.methods)
+}
+
+func (b byPosition) Less(i int, j int) bool {
+	if b.positions[i].Filename != b.positions[j].Filename {
+		return b.positions[i].Filename < b.positions[j].Filename
+	}
+	return b.positions[i].Offset < b.positions[j].Offset
+}
+
+func (b byPosition) Swap(i int, j int) {
+	b.methods[i], b.methods[j] = b.methods[j], b.methods[i]
+	b.positions[i], b.positions[j] = b.positions[j], b.positions[i]
 }
 
-func parseFunc(ctx context.Context, pkg *packages.Package, locals map[string]string, name string, f *ast.FuncType) ([]*Import, *Method, error) {
+func parseFunc(pkg *packages.Package, name string, f *ast.FuncType) ([]*Import, *Method, error) {
 	var method = &Method{Name: name, In: make([]*Parameter, 0), Out: make([]*Parameter, 0)}
 	var used []*Import
 	if f.Params != nil {
-		for offset, arg := range f.Params.List {
-			var param = &Parameter{Name: fmt.Sprintf("param%d", offset)}
-			if len(arg.Names) > 0 {
-				param.Name = arg.Names[0].String()
-			}
-			var u, t, e = parseType(ctx, pkg, locals, arg.Type)
-			if e != nil {
-				return nil, nil, e
-			}
-			used = append(used, u...)
-			param.Type = t
-			method.In = append(method.In, param)
+		var u, params, e = parseFields(pkg, f.Params)
+		if e != nil {
+			return nil, nil, e
 		}
+		used = append(used, u...)
+		method.In = params
 	}
 	if f.Results != nil {
-		for offset, arg := range f.Results.List {
-			var param = &Parameter{Name: fmt.Sprintf("result%d", offset)}
-			if len(arg.Names) > 0 {
-				param.Name = arg.Names[0].String()
-			}
-			var u, t, e = parseType(ctx, pkg, locals, arg.Type)
-			if e != nil {
-				return nil, nil, e
-			}
-			used = append(used, u...)
-			param.Type = t
-			method.Out = append(method.Out, param)
+		var u, params, e = parseFields(pkg, f.Results)
+		if e != nil {
+			return nil, nil, e
 		}
+		used = append(used, u...)
+		method.Out = params
 	}
 	return used, method, nil
 }
 
-func parseInterface(ctx context.Context, pkg *packages.Package, locals map[string]string, name, srcPkgAlias string, i *ast.InterfaceType) ([]*Import, *Interface, error) {
-	var ifcType Type
-	if alias := locals[pkg.PkgPath]; alias != "" {
-		ifcType = &TypeExported{Package: alias, Type: TypeBuiltin(name)}
-	} else {
-		ifcType = TypeBuiltin(name)
+// parseFields converts a parameter or result list into one Parameter per
+// name. A field such as `one, two int` produces two parameters. Unnamed and
+// blank fields produce a parameter with an empty name which is filled in
+// later by nameParameters.
+func parseFields(pkg *packages.Package, fields *ast.FieldList) ([]*Import, []*Parameter, error) {
+	var params = make([]*Parameter, 0, len(fields.List))
+	var used []*Import
+	for _, arg := range fields.List {
+		var u, t, e = parseType(pkg, arg.Type)
+		if e != nil {
+			return nil, nil, e
+		}
+		used = append(used, u...)
+		if len(arg.Names) < 1 {
+			params = append(params, &Parameter{Type: t})
+			continue
+		}
+		for _, name := range arg.Names {
+			var param = &Parameter{Name: name.String(), Type: t}
+			if param.Name == "_" {
+				param.Name = ""
+			}
+			params = append(params, param)
+		}
 	}
-	var iface = &Interface{SrcType: ifcType, Name: name, Methods: make([]*Method, 0)}
+	return used, params, nil
+}
+
+func parseInterface(pkg *packages.Package, name string, i *ast.InterfaceType) ([]*Import, *Interface, error) {
+	var iface = &Interface{SrcType: localType(pkg, name), Name: name, Methods: make([]*Method, 0)}
 	var used []*Import
 	for _, attribute := range i.Methods.List {
 		switch n := attribute.Type.(type) {
 		case *ast.FuncType:
-			var u, m, e = parseFunc(ctx, pkg, locals, attribute.Names[0].String(), n)
+			var u, m, e = parseFunc(pkg, attribute.Names[0].String(), n)
 			if e != nil {
 				return nil, nil, e
 			}
+			m.pkgPath = pkg.PkgPath
+			m.pos = pkg.Fset.Position(attribute.Pos())
 			used = append(used, u...)
 			iface.Methods = append(iface.Methods, m)
 		case *ast.Ident:
-			var u, ifs, err = loadInterface(ctx, pkg, n.String(), srcPkgAlias)
+			var u, ifs, err = loadInterface(pkg, n.String())
 			if err != nil {
 				return nil, nil, fmt.Errorf(
 					"missing local embedded interface %s: %v",
@@ -486,18 +734,14 @@ func parseInterface(ctx context.Context, pkg *packages.Package, locals map[strin
 			used = append(used, u...)
 			iface.Methods = append(iface.Methods, ifs.Methods...)
 		case *ast.SelectorExpr:
-			pkgName := n.X.(*ast.Ident).String()
-			pkgName = locals[pkgName]
-			remotePkg := pkg.Imports[pkgName]
-			u, ifs, err := loadInterface(ctx, remotePkg, n.Sel.String(), srcPkgAlias)
+			u, ifs, err := convertInterface(pkg, n.Sel.String(), pkg.TypesInfo.TypeOf(n))
 			if err != nil {
 				return nil, nil, fmt.Errorf(
-					"missing remote embedded interface %s.%s: %v",
-					remotePkg.PkgPath, n.Sel.String(), err,
+					"missing remote embedded interface %s: %v",
+					n.Sel.String(), err,
 				)
 			}
 			used = append(used, u...)
-			used = append(used, &Import{Path: remotePkg.PkgPath, Package: remotePkg.Name})
 			iface.Methods = append(iface.Methods, ifs.Methods...)
 		default:
 			continue
@@ -506,28 +750,20 @@ func parseInterface(ctx context.Context, pkg *packages.Package, locals map[strin
 	return used, iface, nil
 }
 
-func locals(ctx context.Context, pkg *packages.Package, f *ast.File) map[string]string {
-	results := make(map[string]string)
-	for _, imp := range f.Imports {
-		pth := imp.Path.Value[1 : len(imp.Path.Value)-1]
-		if imp.Name != nil {
-			results[imp.Name.Name] = pth
-			continue
-		}
-		results[pkg.Imports[pth].Name] = pth
-	}
-	return results
+// localType returns a reference to a type defined in the given package.
+func localType(pkg *packages.Package, name string) Type {
+	return &TypeExported{Package: pkg.Name, Path: pkg.PkgPath, Type: TypeBuiltin(name)}
 }
 
 func filterUniqueImports(imports []*Import) []*Import {
 	newImports := make([]*Import, 0, len(imports))
 	importsMap := make(map[string]bool, len(imports))
 	for _, imp := range imports {
-		if importsMap[imp.Package] {
+		if importsMap[imp.Path] {
 			continue
 		}
 		newImports = append(newImports, imp)
-		importsMap[imp.Package] = true
+		importsMap[imp.Path] = true
 	}
 	return newImports
 }
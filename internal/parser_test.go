@@ -6,6 +6,8 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+
+	"golang.org/x/tools/go/packages"
 )
 
 func TestParserSuccess(t *testing.T) {
@@ -25,7 +27,7 @@ func TestParserSuccess(t *testing.T) {
 		"IndirectThirdPartyInterfaceExtension",
 		"IndirectThirdPartyInterfaceAlias",
 	}
-	pkg, err := LoadPackage(ctx, path, "", names)
+	pkg, err := LoadPackage(ctx, path, Destination{}, names, LoadOptions{})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -51,7 +53,7 @@ func TestParserSuccessCustomPackageName(t *testing.T) {
 		"IndirectThirdPartyInterfaceExtension",
 		"IndirectThirdPartyInterfaceAlias",
 	}
-	pkg, err := LoadPackage(ctx, path, "custom", names)
+	pkg, err := LoadPackage(ctx, path, Destination{Name: "custom"}, names, LoadOptions{})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -63,12 +65,12 @@ func TestParserSuccessCustomPackageName(t *testing.T) {
 	}
 	found := false
 	for _, imp := range pkg.Imports {
-		if imp.Path == path && imp.Package == sourceAlias {
+		if imp.Path == path && imp.Package == "happy" {
 			found = true
 		}
 	}
 	if !found {
-		t.Fatalf("did not inject a source package alias: %v", getImportsPaths(pkg.Imports))
+		t.Fatalf("did not import the source package: %v", getImportsPaths(pkg.Imports))
 	}
 }
 
@@ -80,7 +82,7 @@ func TestParserFailure(t *testing.T) {
 	}{}
 	for _, testCase := range testCases {
 		t.Run(testCase.name, func(t *testing.T) {
-			_, err := LoadPackage(context.Background(), testCase.path, "", testCase.names)
+			_, err := LoadPackage(context.Background(), testCase.path, Destination{}, testCase.names, LoadOptions{})
 			if err == nil {
 				t.FailNow()
 			}
@@ -91,10 +93,11 @@ func TestParserFailure(t *testing.T) {
 func TestParserSuccessSub(t *testing.T) {
 	ctx := context.Background()
 	path := "github.com/kevinconway/wrapgen/v2/internal/test/sub/happy"
+	dstPath := "github.com/kevinconway/wrapgen/v2/internal/test/happy"
 	names := []string{
 		"Demo",
 	}
-	pkg, err := LoadPackage(ctx, path, "happy", names)
+	pkg, err := LoadPackage(ctx, path, ParseDestination(dstPath), names, LoadOptions{})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -104,14 +107,45 @@ func TestParserSuccessSub(t *testing.T) {
 	if pkg.Name != "happy" {
 		t.Fatalf("did not use correct output package name: %s", pkg.Name)
 	}
-	found := false
-	for _, imp := range pkg.Imports {
-		if imp.Path == path && imp.Package == sourceAlias {
-			found = true
-		}
+	importsPaths := getImportsPaths(pkg.ImportsWithSource)
+	expectedImportsPaths := []string{
+		"happy:github.com/kevinconway/wrapgen/v2/internal/test/sub/happy",
 	}
-	if !found {
-		t.Fatalf("did not inject a source package alias: %v", getImportsPaths(pkg.Imports))
+	if !reflect.DeepEqual(importsPaths, expectedImportsPaths) {
+		t.Fatalf("unexpected imports with source: %v", importsPaths)
+	}
+	method := pkg.Interfaces[0].Methods[0]
+	if typ := method.In[0].Type.String(); typ != "ExportedStruct" {
+		t.Fatalf("destination type was qualified: %s", typ)
+	}
+	if typ := method.In[1].Type.String(); typ != "happy.DemoType" {
+		t.Fatalf("source type was not qualified: %s", typ)
+	}
+	if typ := method.Out[0].Type.String(); typ != "NonInterfaceAlias" {
+		t.Fatalf("destination type was qualified: %s", typ)
+	}
+}
+
+func TestParserSourceAlias(t *testing.T) {
+	ctx := context.Background()
+	path := "github.com/kevinconway/wrapgen/v2/internal/test/sub/happy"
+	names := []string{
+		"Demo",
+	}
+	pkg, err := LoadPackage(ctx, path, ParseDestination("wrappers"), names, LoadOptions{})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	importsPaths := getImportsPaths(pkg.ImportsWithSource)
+	expectedImportsPaths := []string{
+		"happy:github.com/kevinconway/wrapgen/v2/internal/test/happy",
+		"srcPkgAlias:github.com/kevinconway/wrapgen/v2/internal/test/sub/happy",
+	}
+	if !reflect.DeepEqual(importsPaths, expectedImportsPaths) {
+		t.Fatalf("unexpected imports with source: %v", importsPaths)
+	}
+	if typ := pkg.Interfaces[0].SrcType.String(); typ != "srcPkgAlias.Demo" {
+		t.Fatalf("source type did not use the alias: %s", typ)
 	}
 }
 
@@ -132,7 +166,7 @@ func TestParserUniqueImports(t *testing.T) {
 		"IndirectThirdPartyInterfaceExtension",
 		"IndirectThirdPartyInterfaceAlias",
 	}
-	pkg, err := LoadPackage(ctx, path, "", names)
+	pkg, err := LoadPackage(ctx, path, Destination{}, names, LoadOptions{})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -151,7 +185,7 @@ func TestParserImportsWithoutSource(t *testing.T) {
 	names := []string{
 		"ExportedInterfaceWithRemoteEmbedded",
 	}
-	pkg, err := LoadPackage(ctx, path, "", names)
+	pkg, err := LoadPackage(ctx, path, Destination{}, names, LoadOptions{})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -177,7 +211,7 @@ func TestParserImportsWithoutSourceDest(t *testing.T) {
 	names := []string{
 		"ExportedInterfaceWithRemoteEmbedded",
 	}
-	pkg, err := LoadPackage(ctx, path, "wrappers", names)
+	pkg, err := LoadPackage(ctx, path, Destination{Name: "wrappers"}, names, LoadOptions{})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -190,8 +224,8 @@ func TestParserImportsWithoutSourceDest(t *testing.T) {
 	}
 	importsWithSourcePaths := getImportsPaths(pkg.ImportsWithSource)
 	expectedImportsWithSourcePaths := []string{
+		"happy:github.com/kevinconway/wrapgen/v2/internal/test/happy",
 		"io:io",
-		"srcPkgAlias:github.com/kevinconway/wrapgen/v2/internal/test/happy",
 	}
 	if !reflect.DeepEqual(importsWithSourcePaths, expectedImportsWithSourcePaths) {
 		t.Fatalf("unexpected imports with source: %v", importsWithSourcePaths)
@@ -204,7 +238,7 @@ func TestParserImportsWithSource(t *testing.T) {
 	names := []string{
 		"ExportedInterface",
 	}
-	pkg, err := LoadPackage(ctx, path, "", names)
+	pkg, err := LoadPackage(ctx, path, Destination{}, names, LoadOptions{})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
@@ -234,26 +268,26 @@ func TestParserImportsWithSourceDest(t *testing.T) {
 	names := []string{
 		"ExportedInterface",
 	}
-	pkg, err := LoadPackage(ctx, path, "wrappers", names)
+	pkg, err := LoadPackage(ctx, path, Destination{Name: "wrappers"}, names, LoadOptions{})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
 	importsPaths := getImportsPaths(pkg.Imports)
 	expectedImportsPaths := []string{
+		"happy:github.com/kevinconway/wrapgen/v2/internal/test/happy",
 		"http:net/http",
 		"os:os",
 		"pflag:github.com/spf13/pflag",
-		"srcPkgAlias:github.com/kevinconway/wrapgen/v2/internal/test/happy",
 	}
 	if !reflect.DeepEqual(importsPaths, expectedImportsPaths) {
 		t.Fatalf("unexpected imports: %v", importsPaths)
 	}
 	importsWithSourcePaths := getImportsPaths(pkg.ImportsWithSource)
 	expectedImportsWithSourcePaths := []string{
+		"happy:github.com/kevinconway/wrapgen/v2/internal/test/happy",
 		"http:net/http",
 		"os:os",
 		"pflag:github.com/spf13/pflag",
-		"srcPkgAlias:github.com/kevinconway/wrapgen/v2/internal/test/happy",
 	}
 	if !reflect.DeepEqual(importsWithSourcePaths, expectedImportsWithSourcePaths) {
 		t.Fatalf("unexpected imports with source: %v", importsWithSourcePaths)
@@ -268,3 +302,63 @@ func getImportsPaths(imports []*Import) []string {
 	sort.Strings(importsPaths)
 	return importsPaths
 }
+
+func TestParserMethodOrder(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		path     string
+		name     string
+		expected []string
+	}{
+		// Interfaces of other packages are read from type information which
+		// orders methods by name.
+		{"io", "ReadWriteCloser", []string{"Read", "Write", "Close"}},
+		{"./test/happy", "RemoteInterfaceExtension", []string{"Read"}},
+		{"./test/happy", "ExportedInterfaceWith3rdPartyEmbedded", []string{"String", "Set", "Type"}},
+		// Methods declared in other files are ordered by the name of the
+		// file.
+		{"./test/embedded", "Local", []string{"Second", "First", "Third"}},
+	}
+	for _, testCase := range testCases {
+		pkg, err := LoadPackage(ctx, testCase.path, Destination{}, []string{testCase.name}, LoadOptions{})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		var names []string
+		for _, method := range pkg.Interfaces[0].Methods {
+			names = append(names, method.Name)
+		}
+		if !reflect.DeepEqual(names, testCase.expected) {
+			t.Fatalf("%s: expected methods %v but got %v", testCase.name, testCase.expected, names)
+		}
+	}
+}
+
+func BenchmarkLoadPackage(b *testing.B) {
+	ctx := context.Background()
+	path := "./test/happy"
+	names := []string{
+		"ExportedInterface",
+		"ExportedInterfaceWithRemoteEmbedded",
+		"ExportedInterfaceWith3rdPartyEmbedded",
+		"RemoteInterfaceExtension",
+		"IndirectThirdPartyInterfaceAlias",
+	}
+	b.Run("LoadPackage", func(b *testing.B) {
+		for x := 0; x < b.N; x = x + 1 {
+			if _, err := LoadPackage(ctx, path, Destination{}, names, LoadOptions{}); err != nil {
+				b.Fatal(err.Error())
+			}
+		}
+	})
+	// LoadAllSyntax is the mode that was used before packages were loaded
+	// once with the minimal mode. It is kept here as a point of comparison.
+	b.Run("LoadAllSyntax", func(b *testing.B) {
+		for x := 0; x < b.N; x = x + 1 {
+			conf := &packages.Config{Mode: packages.LoadAllSyntax, Context: ctx}
+			if _, err := packages.Load(conf, path); err != nil {
+				b.Fatal(err.Error())
+			}
+		}
+	})
+}
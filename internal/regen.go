@@ -0,0 +1,233 @@
+package wrapgen
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"go/ast"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// GeneratedFile is a file with a header that records how wrapgen generated
+// it.
+type GeneratedFile struct {
+	// Path is the location of the file.
+	Path string
+	// Job renders the file again with the recorded parameters.
+	Job *Job
+	// Command is the recorded command that generated the file, if any.
+	Command string
+	// Primary is the destination of the job if the file is one of the
+	// additional files defined by its template, and is empty otherwise.
+	Primary string
+}
+
+// FindGenerated loads the packages that match the given patterns and returns
+// every Go file in them that has a wrapgen header. Test files and files that
+// the current build configuration ignores are included. Files defined by a template
+// alongside its destination are left out because rendering the destination
+// again also renders them. Relative patterns are interpreted from dir, or from
+// the working directory if dir is empty.
+func FindGenerated(ctx context.Context, dir string, patterns ...string) ([]*GeneratedFile, error) {
+	conf := &packages.Config{
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedCompiledGoFiles,
+		Context: ctx,
+		Dir:     dir,
+		Tests:   true,
+	}
+	pkgs, err := packages.Load(conf, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		files []*GeneratedFile
+		errs  []error
+		seen  = make(map[string]bool)
+	)
+	for _, pkg := range pkgs {
+		if err := packageErrors(pkg); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, name := range packageFiles(pkg) {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			content, err := ioutil.ReadFile(name)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			file, ok, err := ParseHeader(name, content)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s: %v", name, err))
+				continue
+			}
+			if ok && file.Primary == "" {
+				files = append(files, file)
+			}
+		}
+	}
+	if len(errs) > 0 {
+		return nil, multiError(errs)
+	}
+	sort.Slice(files, func(i int, j int) bool {
+		return files[i].Path < files[j].Path
+	})
+	return files, nil
+}
+
+// packageFiles returns the Go files of a package along with the files that are
+// compiled in their place and the files that the build configuration ignores.
+// Packages are loaded along with their tests so the same file may appear in
+// more than one package. Files that cgo produces in the build cache do not end
+// in .go and are left out.
+func packageFiles(pkg *packages.Package) []string {
+	var names []string
+	for _, list := range [][]string{pkg.GoFiles, pkg.CompiledGoFiles, pkg.IgnoredFiles} {
+		for _, name := range list {
+			if strings.HasSuffix(name, ".go") {
+				names = append(names, name)
+			}
+		}
+	}
+	return names
+}
+
+// ParseHeader reads the header of a file generated by wrapgen. The result is
+// false if the file has no header. Relative locations in the header are
+// interpreted from the directory of the file.
+func ParseHeader(path string, content []byte) (*GeneratedFile, bool, error) {
+	fields := make(map[string]string)
+	found := false
+	block := false
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), "\r")
+		if !found && (block || strings.HasPrefix(line, "/*")) {
+			// A license may be written as a block comment.
+			block = !strings.Contains(strings.TrimPrefix(line, "/*"), "*/")
+			continue
+		}
+		if !strings.HasPrefix(line, "//") {
+			// The header ends at the first line that is not a comment, and
+			// any license comment before it is skipped.
+			if found || strings.TrimSpace(line) != "" {
+				break
+			}
+			continue
+		}
+		if line == GeneratedPrefix {
+			found = true
+			continue
+		}
+		if !found {
+			continue
+		}
+		parts := strings.SplitN(strings.TrimPrefix(line, "//"), ":", 2)
+		if len(parts) == 2 {
+			fields[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	if !found {
+		return nil, false, nil
+	}
+	for _, key := range []string{"Source", "Interfaces", "Template"} {
+		if fields[key] == "" {
+			return nil, true, fmt.Errorf("header has no %s", key)
+		}
+	}
+	// The template is followed by a hash of its content.
+	template := fields["Template"]
+	if offset := strings.LastIndex(template, " (sha256:"); offset >= 0 {
+		template = template[:offset]
+	}
+	destination := filepath.Base(path)
+	if fields["Primary"] != "" {
+		destination = fields["Primary"]
+	}
+	args := fields["Options"] +
+		" template=" + strconv.Quote(template) +
+		" destination=" + strconv.Quote(destination)
+	job, err := parseDirective(args, filepath.Dir(path))
+	if err != nil {
+		return nil, true, fmt.Errorf("invalid header: %v", err)
+	}
+	job.Source = fields["Source"]
+	for _, name := range strings.Split(fields["Interfaces"], ",") {
+		job.Interfaces = append(job.Interfaces, strings.TrimSpace(name))
+	}
+	result := &GeneratedFile{Path: path, Job: job, Command: fields["Command"]}
+	if fields["Primary"] != "" {
+		result.Primary = job.Destination
+	}
+	return result, true, nil
+}
+
+// FindOrphans returns the generated files whose source package no longer
+// declares every interface that the file was generated from. The result maps
+// the path of each orphaned file to a description of what is missing. Files
+// whose source package cannot be loaded are not orphans because the problem
+// may be temporary. Relative sources are interpreted from dir.
+func FindOrphans(ctx context.Context, dir string, files []*GeneratedFile) (map[string]string, error) {
+	var sources []string
+	seen := make(map[string]bool)
+	for _, file := range files {
+		if !seen[file.Job.Source] {
+			seen[file.Job.Source] = true
+			sources = append(sources, file.Job.Source)
+		}
+	}
+	orphans := make(map[string]string)
+	if len(sources) < 1 {
+		return orphans, nil
+	}
+	// Only the syntax is loaded because the generated files are often part
+	// of the source package and no longer type check once an interface they
+	// refer to is removed.
+	conf := &packages.Config{
+		Mode:    packages.NeedName | packages.NeedFiles | packages.NeedSyntax,
+		Context: ctx,
+		Dir:     dir,
+	}
+	pkgs, err := packages.Load(conf, sources...)
+	if err != nil {
+		return nil, err
+	}
+	declared := make(map[string]map[string]bool)
+	for _, pkg := range pkgs {
+		if len(pkg.GoFiles) < 1 {
+			continue
+		}
+		names := make(map[string]bool)
+		typeSpecs(pkg.Syntax, func(_ *ast.GenDecl, spec *ast.TypeSpec) bool {
+			names[spec.Name.Name] = true
+			return true
+		})
+		declared[pkg.PkgPath] = names
+	}
+	for _, file := range files {
+		names, ok := declared[file.Job.Source]
+		if !ok {
+			continue
+		}
+		var missing []string
+		for _, name := range file.Job.Interfaces {
+			if !names[name] {
+				missing = append(missing, name)
+			}
+		}
+		if len(missing) > 0 {
+			orphans[file.Path] = fmt.Sprintf("%s no longer declares %s", file.Job.Source, strings.Join(missing, ", "))
+		}
+	}
+	return orphans, nil
+}
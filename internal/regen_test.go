@@ -0,0 +1,158 @@
+package wrapgen
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	content := strings.Join([]string{
+		"/*",
+		"Copyright Someone.",
+		"*/",
+		"",
+		"// Code generated by wrapgen. DO NOT EDIT.",
+		"//",
+		"// Version: (devel)",
+		"// Source: io",
+		"// Interfaces: Reader, Writer",
+		"// Template: ../templates/logtime.txt (sha256:00)",
+		`// Options: package=wrappers leftdelim={{ rightdelim=}} legacy-names var.name="a value"`,
+		"// Command: wrapgen run --config wrapgen.yaml",
+		"",
+		"package wrappers",
+		"",
+		"// Source: ignored",
+	}, "\n")
+	file, ok, err := ParseHeader(filepath.Join("root", "gen", "io.go"), []byte(content))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !ok {
+		t.Fatal("expected the header to be found")
+	}
+	expected := &Job{
+		Source:      "io",
+		Interfaces:  []string{"Reader", "Writer"},
+		Template:    filepath.Join("root", "templates", "logtime.txt"),
+		Destination: filepath.Join("root", "gen", "io.go"),
+		Package:     "wrappers",
+		LeftDelim:   "{{",
+		RightDelim:  "}}",
+		LegacyNames: true,
+		Vars:        map[string]string{"name": "a value"},
+	}
+	if !reflect.DeepEqual(file.Job, expected) {
+		t.Fatalf("expected %+v but got %+v", expected, file.Job)
+	}
+	if file.Command != "wrapgen run --config wrapgen.yaml" {
+		t.Fatalf("unexpected command %q", file.Command)
+	}
+
+	// Files defined by the template are rendered again with their primary.
+	secondary := strings.Replace(content, "// Command:", "// Primary: ../io.go\n// Command:", 1)
+	file, _, err = ParseHeader(filepath.Join("root", "gen", "doc", "doc.go"), []byte(secondary))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if file.Primary != expected.Destination || file.Job.Destination != expected.Destination {
+		t.Fatalf("expected the primary %s but got %+v", expected.Destination, file)
+	}
+
+	if _, ok, _ := ParseHeader("plain.go", []byte("// Code generated by other. DO NOT EDIT.\n\npackage plain\n")); ok {
+		t.Fatal("expected a file from another generator to be skipped")
+	}
+	if _, _, err := ParseHeader("broken.go", []byte(GeneratedPrefix+"\n// Source: io\n\npackage broken\n")); err == nil {
+		t.Fatal("expected a header without interfaces to fail")
+	}
+}
+
+func TestFindGenerated(t *testing.T) {
+	dir, err := ioutil.TempDir("test", "regen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+	source := "package regen\n\ntype Getter interface {\n\tGet() string\n}\n\ntype Putter interface {\n\tPut(string)\n}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "regen.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	template := filepath.Join(dir, "template.txt")
+	if err := ioutil.WriteFile(template, []byte("package #! .Name !#\n"), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	runner := &Runner{
+		Fetcher: &FSTemplateFetcher{ReadFn: ioutil.ReadFile},
+		Command: func(*Job) string { return "wrapgen generate" },
+	}
+	var jobs []*Job
+	for _, name := range []string{"Getter", "Putter"} {
+		destination, err := filepath.Abs(filepath.Join(dir, strings.ToLower(name)+"_gen.go"))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		jobs = append(jobs, &Job{
+			Source:      "./" + filepath.ToSlash(dir),
+			Interfaces:  []string{name},
+			Template:    template,
+			Destination: destination,
+			Vars:        map[string]string{"name": name},
+		})
+	}
+	if err := runner.Run(context.Background(), jobs); err != nil {
+		t.Fatal(err.Error())
+	}
+
+	files, err := FindGenerated(context.Background(), "", "./"+filepath.ToSlash(dir))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected 2 generated files but found %d", len(files))
+	}
+	for offset, file := range files {
+		job := jobs[offset]
+		absTemplate, _ := filepath.Abs(template)
+		if file.Path != job.Destination || file.Job.Template != absTemplate || file.Command != "wrapgen generate" {
+			t.Fatalf("unexpected generated file %+v", file)
+		}
+		if !reflect.DeepEqual(file.Job.Interfaces, job.Interfaces) || !reflect.DeepEqual(file.Job.Vars, job.Vars) {
+			t.Fatalf("unexpected job %+v", file.Job)
+		}
+	}
+
+	// Removing an interface orphans the file generated from it.
+	source = source[:strings.Index(source, "type Putter")]
+	if err := ioutil.WriteFile(filepath.Join(dir, "regen.go"), []byte(source), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	orphans, err := FindOrphans(context.Background(), "", files)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(orphans) != 1 || !strings.Contains(orphans[files[1].Path], "no longer declares Putter") {
+		t.Fatalf("expected the putter to be orphaned but got %v", orphans)
+	}
+}
+
+func TestFindGeneratedTests(t *testing.T) {
+	files, err := FindGenerated(context.Background(), "", "./test/generated")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected 1 generated file but found %d", len(files))
+	}
+	file := files[0]
+	if filepath.Base(file.Path) != "getter_gen_test.go" {
+		t.Fatalf("expected the generated test file but found %s", file.Path)
+	}
+	if file.Job.Source != "github.com/kevinconway/wrapgen/v2/internal/test/generated" || !reflect.DeepEqual(file.Job.Interfaces, []string{"Getter"}) {
+		t.Fatalf("unexpected job %+v", file.Job)
+	}
+}
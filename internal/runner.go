@@ -0,0 +1,639 @@
+package wrapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/Masterminds/sprig"
+	"golang.org/x/tools/go/packages"
+)
+
+const (
+	defaultLeftDelim  = "#!"
+	defaultRightDelim = "!#"
+)
+
+// NewTemplate creates an empty template with every function available to
+// wrapgen templates installed. Empty delimiters default to "#!" and "!#".
+func NewTemplate(leftDelim string, rightDelim string) *template.Template {
+	if leftDelim == "" {
+		leftDelim = defaultLeftDelim
+	}
+	if rightDelim == "" {
+		rightDelim = defaultRightDelim
+	}
+	return template.New("wrapgen").
+		Funcs(sprig.TxtFuncMap()).
+		Funcs(TemplateFuncs()).
+		Delims(leftDelim, rightDelim)
+}
+
+// Runner renders a set of jobs. All source packages are loaded with a single
+// call to packages.Load and the jobs are rendered concurrently. A failed job
+// does not stop the others and every failure is reported once all jobs have
+// finished.
+type Runner struct {
+	Fetcher TemplateFetcher
+	// Dir is the directory from which relative sources, templates, and
+	// destinations are interpreted. Defaults to the working directory.
+	Dir string
+	// Concurrency is the maximum number of jobs rendered at once. Zero means
+	// one job per CPU.
+	Concurrency int
+	// Stdout receives the output of jobs that have no destination file, and
+	// any diffs. The output is written in the order of the jobs.
+	Stdout io.Writer
+	// Check compares the output of each job with its destination file rather
+	// than writing it. Any job with a missing or different destination fails.
+	Check bool
+	// Diff writes a unified diff between each destination file and the output
+	// of its job to Stdout rather than writing the destination.
+	Diff bool
+	// Stderr receives warnings about jobs that did not fail.
+	Stderr io.Writer
+	// Raw disables formatting the output with gofmt and goimports.
+	Raw bool
+	// Force writes destination files even if the output does not type check
+	// as part of the destination package. The problems are written to Stderr.
+	Force bool
+	// NoHeader disables the comment placed at the top of every output that
+	// marks it as generated and records how it was made.
+	NoHeader bool
+	// Command returns the command that regenerates the output of a job for
+	// the header. The command is left out of the header if it is nil or
+	// returns an empty string.
+	Command func(job *Job) string
+	// Lock records the content hash of every remote template. Jobs fail if
+	// a template no longer matches its hash, and templates that are not yet
+	// recorded are added and written once all jobs have finished unless Check
+	// or Diff is set. Remote templates are not checked if it is nil.
+	Lock *Lock
+}
+
+// Run renders every job. Jobs with a destination pattern are rendered once
+// for each interface.
+func (r *Runner) Run(ctx context.Context, jobs []*Job) error {
+	jobs, numbers, errs := expandJobs(jobs)
+	outputs := make([][]byte, len(jobs))
+	var (
+		valid        []int
+		sources      []string
+		destinations = make(map[string]int)
+		seen         = make(map[string]bool)
+	)
+	for offset, job := range jobs {
+		if errs[offset] != nil {
+			continue
+		}
+		if dest := r.destination(job); dest != "" {
+			if other, ok := destinations[dest]; ok {
+				if numbers[other] == numbers[offset] {
+					errs[offset] = fmt.Errorf("destination pattern gives the same file for more than one interface")
+				} else {
+					errs[offset] = fmt.Errorf("destination is also written by job %d", numbers[other]+1)
+				}
+				continue
+			}
+			destinations[dest] = offset
+		}
+		valid = append(valid, offset)
+		if !seen[job.Source] {
+			seen[job.Source] = true
+			sources = append(sources, job.Source)
+		}
+	}
+
+	var (
+		pkgs    map[string]*packages.Package
+		pkgErrs map[string]error
+	)
+	if len(sources) > 0 {
+		pkgs, pkgErrs = loadPackages(ctx, r.Dir, sources...)
+	}
+
+	claims := &fileClaims{owners: destinations, numbers: numbers}
+	templates := &templateCache{
+		fetcher: r.Fetcher,
+		entries: make(map[string]*templateEntry),
+	}
+	concurrency := r.Concurrency
+	if concurrency < 1 {
+		concurrency = runtime.NumCPU()
+	}
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, offset := range valid {
+		job := jobs[offset]
+		if err := pkgErrs[job.Source]; err != nil {
+			errs[offset] = fmt.Errorf("failed to load package data: %v", err)
+			continue
+		}
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(offset int, job *Job) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			outputs[offset], errs[offset] = r.run(ctx, job, offset, pkgs[job.Source], templates, claims)
+		}(offset, job)
+	}
+	wg.Wait()
+
+	var result []error
+	if r.Lock != nil && !r.Check && !r.Diff {
+		if err := r.Lock.Write(); err != nil {
+			result = append(result, fmt.Errorf("failed to write %s: %v", r.Lock.Path, err))
+		}
+	}
+	for offset, err := range errs {
+		if outputs[offset] != nil && r.Stdout != nil {
+			if _, writeErr := r.Stdout.Write(outputs[offset]); err == nil {
+				err = writeErr
+			}
+		}
+		if w, ok := err.(warning); ok {
+			if r.Stderr != nil {
+				_, _ = fmt.Fprintf(r.Stderr, "job %d (%s): warning: %v\n", numbers[offset]+1, jobs[offset], w.error)
+			}
+			continue
+		}
+		if err != nil {
+			result = append(result, fmt.Errorf("job %d (%s): %v", numbers[offset]+1, jobs[offset], err))
+		}
+	}
+	if len(result) > 0 {
+		return multiError(result)
+	}
+	return nil
+}
+
+// expandJobs validates the jobs and splits those with a destination pattern
+// into one job for each interface. The original position of each resulting job
+// is returned along with any error for it. Invalid jobs are kept as is.
+func expandJobs(jobs []*Job) ([]*Job, []int, []error) {
+	var (
+		result  []*Job
+		numbers []int
+		errs    []error
+	)
+	for offset, job := range jobs {
+		expanded, err := []*Job{job}, job.validate()
+		if err == nil {
+			if split, splitErr := job.expand(); splitErr != nil {
+				err = splitErr
+			} else {
+				expanded = split
+			}
+		}
+		for _, e := range expanded {
+			result = append(result, e)
+			numbers = append(numbers, offset)
+			errs = append(errs, err)
+		}
+	}
+	return result, numbers, errs
+}
+
+// run renders a single job. The output is returned if the job has no
+// destination file. The diff is returned instead if Diff is set.
+func (r *Runner) run(ctx context.Context, job *Job, offset int, pkg *packages.Package, templates *templateCache, claims *fileClaims) ([]byte, error) {
+	templatePath := r.templatePath(job.Template)
+	templateString, err := templates.fetch(ctx, templatePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch template: %v", err)
+	}
+	if job.TemplateSHA256 != "" {
+		if err := verifySHA256(templatePath, templateString, job.TemplateSHA256); err != nil {
+			return nil, err
+		}
+	}
+	if r.Lock != nil {
+		if err := r.Lock.verify(templatePath, templateString); err != nil {
+			return nil, err
+		}
+	}
+	smap := newSourceMap(path.Base(filepath.ToSlash(job.Template)), templateString)
+	imports := newImportSet(ctx, r.Dir)
+	tmpl, err := NewTemplate(job.LeftDelim, job.RightDelim).
+		Funcs(smap.funcs()).
+		Funcs(imports.funcs()).
+		Parse(templateString)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template: %v", err)
+	}
+	smap.instrument(tmpl)
+	dst, err := r.packageDestination(job)
+	if err != nil {
+		return nil, fmt.Errorf("failed to interpret destination: %v", err)
+	}
+	result, err := newPackage(ctx, pkg, dst, job.Interfaces, LoadOptions{
+		LegacyNames: job.LegacyNames,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to interpret package: %v", err)
+	}
+	result.Vars = job.Vars
+
+	dest := r.destination(job)
+	files, err := r.execute(job, pkg, tmpl, smap, imports, templateString, dest, result)
+	if err != nil {
+		return nil, err
+	}
+	if !r.Raw {
+		for _, file := range files {
+			file.content, err = formatSource(file.path, file.content)
+			if serr, ok := err.(*syntaxError); ok {
+				serr.smap = file.smap
+			}
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	if r.Check || r.Diff {
+		var (
+			diffs []byte
+			errs  []error
+		)
+		for _, file := range files {
+			diff, err := r.compare(file.path, file.content)
+			diffs = append(diffs, diff...)
+			if err != nil {
+				errs = append(errs, err)
+			}
+		}
+		if len(errs) == 1 {
+			return diffs, errs[0]
+		}
+		if len(errs) > 0 {
+			return diffs, multiError(errs)
+		}
+		return diffs, nil
+	}
+	if dest == "" {
+		return files[0].content, nil
+	}
+	for _, file := range files[1:] {
+		if err := claims.claim(file.path, offset); err != nil {
+			return nil, err
+		}
+	}
+	checkErr := r.typeCheck(ctx, dst, files)
+	if checkErr != nil && !r.Force {
+		return nil, checkErr
+	}
+	for _, file := range files {
+		if err := writeFile(file.path, file.content); err != nil {
+			return nil, fmt.Errorf("failed to write destination file: %v", err)
+		}
+	}
+	if checkErr != nil {
+		return nil, warning{checkErr}
+	}
+	return nil, nil
+}
+
+// execute renders the template of a job into the destination file and every
+// additional file that the template defines. Each file imports what it uses.
+func (r *Runner) execute(job *Job, pkg *packages.Package, tmpl *template.Template, smap *sourceMap, imports *importSet, templateString string, dest string, data *Package) ([]*outputFile, error) {
+	render := func(name string, output string) (*outputFile, error) {
+		// The header is written before the template is executed so that
+		// the source map accounts for it.
+		var buff bytes.Buffer
+		if !r.NoHeader {
+			header, err := r.header(job, pkg, templateString, output)
+			if err != nil {
+				return nil, err
+			}
+			_, _ = buff.Write(header)
+		}
+		smap.reset(&buff)
+		imports.reset(data)
+		if err := tmpl.ExecuteTemplate(&buff, name, data); err != nil {
+			return nil, fmt.Errorf("failed to render template: %v", err)
+		}
+		file := &outputFile{path: output, content: buff.Bytes(), smap: smap.reset(nil)}
+		addImports(file, data, imports.file, imports.packageNames)
+		return file, nil
+	}
+	main, err := render(tmpl.Name(), dest)
+	if err != nil {
+		return nil, err
+	}
+	files := []*outputFile{main}
+	var names []string
+	for _, t := range tmpl.Templates() {
+		if strings.HasPrefix(t.Name(), FilePrefix) {
+			names = append(names, t.Name())
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if dest == "" {
+			return nil, fmt.Errorf("a destination file is required for the files defined by the template")
+		}
+		rel, err := fileName(job, strings.TrimPrefix(name, FilePrefix))
+		if err != nil {
+			return nil, err
+		}
+		filePath, err := definedFile(dest, rel)
+		if err != nil {
+			return nil, err
+		}
+		file, err := render(name, filePath)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
+
+// typeCheck type checks each file that is part of a package within a module.
+// The files that belong to the same package are checked together.
+func (r *Runner) typeCheck(ctx context.Context, dst Destination, files []*outputFile) error {
+	var (
+		paths  []string
+		groups = make(map[string][]*outputFile)
+	)
+	for offset, file := range files {
+		pkgPath := dst.Path
+		if offset > 0 && filepath.Dir(file.path) != filepath.Dir(files[0].path) {
+			fileDst, err := DestinationFromFile(file.path)
+			if err != nil {
+				return err
+			}
+			pkgPath = fileDst.Path
+		}
+		// The output can only be type checked as part of a package which
+		// requires the destination to be within a module.
+		if pkgPath == "" {
+			continue
+		}
+		if _, ok := groups[pkgPath]; !ok {
+			paths = append(paths, pkgPath)
+		}
+		groups[pkgPath] = append(groups[pkgPath], file)
+	}
+	var errs []error
+	for _, pkgPath := range paths {
+		if err := typeCheck(ctx, pkgPath, groups[pkgPath]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	if len(errs) > 0 {
+		return multiError(errs)
+	}
+	return nil
+}
+
+// FilePrefix begins the name of a template defined within a template that is
+// rendered into a file of its own. The remainder of the name is the path of
+// the file relative to the directory of the destination. The path may not be
+// absolute or lead out of that directory. It may be a pattern like those of
+// destinations to give each interface a file of its own. For example:
+//
+//	#! define "file:fake_test.go" !#package #! .Name !#...#! end !#
+const FilePrefix = "file:"
+
+// fileName renders the name of a file defined by a template when it is a
+// pattern. Patterns are rendered like a destination pattern and require a job
+// with a single interface. A job that was split from a destination pattern
+// must name its files with a pattern because each interface would otherwise
+// write to the same file.
+func fileName(job *Job, name string) (string, error) {
+	if !IsDestinationPattern(name) {
+		if job.split {
+			example := path.Join(path.Dir(name), "{{ .Interface.Name | snakecase }}_"+path.Base(name))
+			return "", fmt.Errorf("the template defines the file %q for every interface of the destination pattern; name it with a pattern such as %q", name, example)
+		}
+		return name, nil
+	}
+	if len(job.Interfaces) != 1 {
+		return "", fmt.Errorf("the template defines the file %q with a pattern which requires a single interface", name)
+	}
+	pattern, err := parsePattern("file", name)
+	if err != nil {
+		return "", fmt.Errorf("invalid file pattern: %v", err)
+	}
+	rendered, err := renderPattern(pattern, job.Interfaces[0])
+	if err != nil {
+		return "", fmt.Errorf("failed to render file pattern: %v", err)
+	}
+	return rendered, nil
+}
+
+// definedFile returns the path of a file defined by a template. The name is
+// relative to the directory of the destination and must stay within it, both
+// as written and once any symbolic links that already exist are followed.
+func definedFile(dest string, name string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("the template defines a file with no name")
+	}
+	if path.IsAbs(filepath.ToSlash(name)) || filepath.IsAbs(name) || filepath.VolumeName(name) != "" {
+		return "", fmt.Errorf("the template defines a file with an absolute path %q", name)
+	}
+	for _, part := range strings.Split(filepath.ToSlash(name), "/") {
+		if part == ".." {
+			return "", fmt.Errorf("the template defines a file %q that refers to a parent directory", name)
+		}
+	}
+	dir := filepath.Dir(dest)
+	filePath := filepath.Join(dir, filepath.FromSlash(name))
+	if filePath == dest {
+		return "", fmt.Errorf("the template defines a file that is the destination")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	absFile, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+	if !within(absDir, absFile) || !within(resolve(absDir), resolve(absFile)) {
+		return "", fmt.Errorf("the template defines a file %q outside of %s", name, dir)
+	}
+	return filePath, nil
+}
+
+// within reports whether file is below dir. Both paths must be absolute.
+func within(dir string, file string) bool {
+	rel, err := filepath.Rel(dir, file)
+	if err != nil {
+		return false
+	}
+	return rel != "." && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// resolve follows the symbolic links in the part of an absolute path that
+// exists. The rest of the path is kept as is.
+func resolve(file string) string {
+	var rest []string
+	for dir := file; ; {
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...)
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return file
+		}
+		rest = append([]string{filepath.Base(dir)}, rest...)
+		dir = parent
+	}
+}
+
+// outputFile is a file rendered by a job.
+type outputFile struct {
+	// path is empty if the file is written to Stdout.
+	path    string
+	content []byte
+	smap    *sourceMap
+}
+
+// insert adds text to the content at the given offset.
+func (f *outputFile) insert(offset int, text []byte) {
+	f.smap.insert(offset, text)
+	f.content = f.smap.out.Bytes()
+}
+
+// fileClaims ensures that each file is written by a single job. Jobs are
+// identified by their offset after expansion and numbers maps each offset to
+// the position of the job as given.
+type fileClaims struct {
+	lock    sync.Mutex
+	owners  map[string]int
+	numbers []int
+}
+
+// claim records that the job at the given offset writes to the file. An error
+// is returned if another job already writes to it.
+func (c *fileClaims) claim(file string, offset int) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	other, ok := c.owners[file]
+	switch {
+	case !ok || other == offset:
+		c.owners[file] = offset
+		return nil
+	case c.numbers[other] == c.numbers[offset]:
+		return fmt.Errorf("%s is written for more than one interface", file)
+	}
+	return fmt.Errorf("%s is also written by job %d", file, c.numbers[other]+1)
+}
+
+// warning is a problem with a job that does not cause it to fail.
+type warning struct {
+	error
+}
+
+// packageDestination determines the package that the output of the job will
+// be a part of. When the job writes to a file, and the package is not given as
+// an import path, the destination is inferred from the location of the file.
+func (r *Runner) packageDestination(job *Job) (Destination, error) {
+	dst := ParseDestination(job.Package)
+	dest := r.destination(job)
+	if dest == "" || dst.Path != "" {
+		return dst, nil
+	}
+	fileDst, err := DestinationFromFile(dest)
+	if err != nil {
+		return Destination{}, err
+	}
+	if dst.Name != "" {
+		if err := checkPackageName(dest, dst.Name); err != nil {
+			return Destination{}, err
+		}
+	}
+	if fileDst.Path == "" {
+		return dst, nil
+	}
+	if dst.Name != "" {
+		fileDst.Name = dst.Name
+	}
+	return fileDst, nil
+}
+
+// checkPackageName reports an error if a file with the given package name
+// would not compile alongside the other files in its directory. A test file
+// may also use the name of the external test package.
+func checkPackageName(file string, name string) error {
+	file, err := filepath.Abs(file)
+	if err != nil {
+		return err
+	}
+	dir := filepath.Dir(file)
+	existing, err := packageNameFromDir(dir, file)
+	if err != nil {
+		return err
+	}
+	if existing == "" || existing == name {
+		return nil
+	}
+	if strings.HasSuffix(file, "_test.go") && name == existing+"_test" {
+		return nil
+	}
+	return fmt.Errorf("package %s does not match package %s of the other files in %s", name, existing, dir)
+}
+
+// destination returns the file that the job is written to or an empty string
+// if the job is written to Stdout.
+func (r *Runner) destination(job *Job) string {
+	if job.Destination == "" || job.Destination == "-" {
+		return ""
+	}
+	return r.path(job.Destination)
+}
+
+func (r *Runner) templatePath(path string) string {
+	if !isLocalPath(path) {
+		return path
+	}
+	return r.path(path)
+}
+
+func (r *Runner) path(path string) string {
+	if r.Dir == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(r.Dir, path)
+}
+
+// templateCache fetches each template once regardless of how many jobs use
+// it.
+type templateCache struct {
+	fetcher TemplateFetcher
+	lock    sync.Mutex
+	entries map[string]*templateEntry
+}
+
+type templateEntry struct {
+	once  sync.Once
+	value string
+	err   error
+}
+
+func (c *templateCache) fetch(ctx context.Context, path string) (string, error) {
+	c.lock.Lock()
+	entry, ok := c.entries[path]
+	if !ok {
+		entry = &templateEntry{}
+		c.entries[path] = entry
+	}
+	c.lock.Unlock()
+	entry.once.Do(func() {
+		entry.value, entry.err = c.fetcher.FetchTemplate(ctx, path)
+	})
+	return entry.value, entry.err
+}
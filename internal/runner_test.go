@@ -0,0 +1,518 @@
+package wrapgen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRunner(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	fetches := 0
+	var stdout bytes.Buffer
+	runner, root := newTestRunner(t, "")
+	runner.Fetcher = &FSTemplateFetcher{ReadFn: func(path string) ([]byte, error) {
+		if filepath.Base(path) != "names.txt" {
+			return nil, errors.New("missing")
+		}
+		fetches = fetches + 1
+		return []byte(`#! .Name !#:#! index .Vars "suffix" !#:#! range .Interfaces !##! .Name !#,#! end !#` + "\n"), nil
+	}}
+	runner.Dir = wd
+	runner.Concurrency = 2
+	runner.Stdout = &stdout
+	// The template does not produce Go code.
+	runner.Raw = true
+	jobs := []*Job{
+		{
+			Source:      "./test/happy",
+			Interfaces:  []string{"ExportedInterface"},
+			Template:    "names.txt",
+			Destination: "first.go",
+			Package:     "first",
+		},
+		{
+			Source:     "io",
+			Interfaces: []string{"Reader", "Writer"},
+			Template:   "names.txt",
+			Package:    "second",
+			Vars:       map[string]string{"suffix": "2"},
+		},
+		{
+			Source:     "./test/happy",
+			Interfaces: []string{"Missing"},
+			Template:   "names.txt",
+		},
+		{
+			Source:      "io",
+			Interfaces:  []string{"Reader"},
+			Template:    "missing.txt",
+			Destination: "fourth.go",
+		},
+		{
+			Source:      "io",
+			Interfaces:  []string{"Writer"},
+			Template:    "names.txt",
+			Destination: "first.go",
+		},
+		{
+			Source:     "io",
+			Interfaces: []string{"Reader"},
+			Template:   "names.txt",
+			Package:    "third",
+		},
+		{
+			Source:   "io",
+			Template: "names.txt",
+		},
+	}
+	for _, job := range jobs {
+		if job.Destination != "" {
+			job.Destination = filepath.Join(root, job.Destination)
+		}
+	}
+
+	err = runner.Run(context.Background(), jobs)
+	if err == nil {
+		t.Fatal("expected failing jobs to be reported")
+	}
+	for _, expected := range []string{
+		"job 3 (", "interface Missing not found",
+		"job 4 (", "failed to fetch template",
+		"job 5 (", "destination is also written by job 1",
+		"job 7 (", "no interfaces set",
+	} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in %v", expected, err)
+		}
+	}
+	for _, unexpected := range []string{"job 1 (", "job 2 (", "job 6 ("} {
+		if strings.Contains(err.Error(), unexpected) {
+			t.Fatalf("did not expect %q in %v", unexpected, err)
+		}
+	}
+	if fetches != 1 {
+		t.Fatalf("expected the template to be fetched once but it was fetched %d times", fetches)
+	}
+
+	b, err := ioutil.ReadFile(filepath.Join(root, "first.go"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(b) != "first::ExportedInterface,\n" {
+		t.Fatalf("unexpected destination content %q", string(b))
+	}
+	if stdout.String() != "second:2:Reader,Writer,\nthird::Reader,\n" {
+		t.Fatalf("unexpected stdout content %q", stdout.String())
+	}
+}
+
+func TestRunnerDestinationPattern(t *testing.T) {
+	runner, root := newTestRunner(t, "package #! .Name !#\n\nimport (\n#! range .Imports !#\t#! .Package !# \"#! .Path !#\"\n#! end !#)\n\n#! range .Interfaces !#var _ #! .SrcType !#\n#! end !#")
+	// The imports are written as is rather than pruned by goimports.
+	runner.Raw = true
+	jobs := []*Job{
+		{
+			Source:      "net/http",
+			Interfaces:  []string{"Handler", "CookieJar"},
+			Template:    "template.txt",
+			Destination: filepath.Join(root, "{{ .Interface.Name | snakecase }}.go"),
+			Package:     "wrappers",
+		},
+		{
+			Source:      "io",
+			Interfaces:  []string{"Reader", "Writer"},
+			Template:    "template.txt",
+			Destination: filepath.Join(root, "same.go") + "{{ if false }}{{ end }}",
+		},
+	}
+	err := runner.Run(context.Background(), jobs)
+	if err == nil || !strings.Contains(err.Error(), "job 2 (") || !strings.Contains(err.Error(), "same file for more than one interface") {
+		t.Fatalf("expected a pattern that gives one file to fail but got %v", err)
+	}
+	if strings.Contains(err.Error(), "job 1 (") {
+		t.Fatalf("did not expect the first job to fail: %v", err)
+	}
+	// Each file only imports the packages used by its own interface.
+	for name, expected := range map[string]bool{"handler.go": false, "cookie_jar.go": true} {
+		b, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if strings.Contains(string(b), `"net/url"`) != expected {
+			t.Errorf("%s: unexpected imports in\n%s", name, string(b))
+		}
+	}
+}
+
+func TestRunnerPackageName(t *testing.T) {
+	runner, root := newTestRunner(t, "package #! .Name !#\n")
+	testCases := []struct {
+		name        string
+		destination string
+		pkg         string
+		expected    string
+	}{
+		{"same", "same.go", "wrappers", "package wrappers\n"},
+		{"external test", "external_test.go", "wrappers_test", "package wrappers_test\n"},
+		{"different", "different.go", "other", ""},
+		{"different test", "different_test.go", "other_test", ""},
+	}
+	for _, testCase := range testCases {
+		testCase := testCase
+		t.Run(testCase.name, func(t *testing.T) {
+			dir := filepath.Join(root, testCase.name)
+			if err := os.Mkdir(dir, 0755); err != nil {
+				t.Fatal(err.Error())
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "existing.go"), []byte("package wrappers\n"), 0644); err != nil {
+				t.Fatal(err.Error())
+			}
+			dest := filepath.Join(dir, testCase.destination)
+			err := runner.Run(context.Background(), []*Job{readerJob(dest, testCase.pkg)})
+			if testCase.expected == "" {
+				if err == nil || !strings.Contains(err.Error(), "does not match package wrappers") {
+					t.Fatalf("expected a mismatched package name to fail but got %v", err)
+				}
+				if _, err := os.Stat(dest); !os.IsNotExist(err) {
+					t.Fatal("wrote a file with a mismatched package name")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			b, err := ioutil.ReadFile(dest)
+			if err != nil {
+				t.Fatal(err.Error())
+			}
+			if string(b) != testCase.expected {
+				t.Fatalf("expected %q but got %q", testCase.expected, string(b))
+			}
+		})
+	}
+}
+
+func TestRunnerFiles(t *testing.T) {
+	template := strings.Join([]string{
+		"package #! .Name !#",
+		"",
+		"var Main = 1",
+		`#! define "file:main_test.go" !#package #! .Name !#`,
+		"",
+		"var Test = 2",
+		`#! end !##! define "file:doc/doc.go" !#// Package doc`,
+		"package doc",
+		"#! end !#",
+	}, "\n")
+	var stdout bytes.Buffer
+	runner, root := newTestRunner(t, template)
+	runner.Stdout = &stdout
+	// The files name the destination as their primary in the header.
+	runner.NoHeader = false
+	jobs := []*Job{readerJob(filepath.Join(root, "main.go"), "wrappers"), readerJob("", "")}
+	err := runner.Run(context.Background(), jobs)
+	if err == nil || !strings.Contains(err.Error(), "job 2 (") || !strings.Contains(err.Error(), "a destination file is required") {
+		t.Fatalf("expected a template that defines files to require a destination but got %v", err)
+	}
+	if strings.Contains(err.Error(), "job 1 (") {
+		t.Fatalf("did not expect the first job to fail: %v", err)
+	}
+	// Each file is formatted on its own and names the destination as its
+	// primary.
+	for name, expected := range map[string][]string{
+		"main.go":      {"\npackage wrappers\n\nvar Main = 1\n"},
+		"main_test.go": {"// Primary: main.go\n", "\npackage wrappers\n\nvar Test = 2\n"},
+		"doc/doc.go":   {"// Primary: ../main.go\n", "\n// Package doc\npackage doc\n"},
+	} {
+		b, err := ioutil.ReadFile(filepath.Join(root, filepath.FromSlash(name)))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		for _, part := range expected {
+			if !strings.Contains(string(b), part) {
+				t.Errorf("%s: expected %q in\n%s", name, part, string(b))
+			}
+		}
+		if name == "main.go" && strings.Contains(string(b), "Primary") {
+			t.Errorf("did not expect the destination to have a primary")
+		}
+	}
+
+	// Another job may not write to a file defined by the template.
+	jobs[1].Destination = filepath.Join(root, "main_test.go")
+	jobs[1].Template = "other.txt"
+	runner.Fetcher = &FSTemplateFetcher{ReadFn: func(path string) ([]byte, error) {
+		if filepath.Base(path) == "other.txt" {
+			return []byte("package #! .Name !#\n"), nil
+		}
+		return []byte(template), nil
+	}}
+	err = runner.Run(context.Background(), jobs)
+	if err == nil || !strings.Contains(err.Error(), "main_test.go is also written by job 2") {
+		t.Fatalf("expected a conflict with the other job but got %v", err)
+	}
+}
+
+func TestRunnerFilesOutside(t *testing.T) {
+	runner, root := newTestRunner(t, "")
+	dir := filepath.Join(root, "wrappers")
+	outside := filepath.Join(root, "outside")
+	for _, d := range []string{dir, outside} {
+		if err := os.Mkdir(d, 0755); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	// The link is within the directory of the destination but leads out of
+	// it.
+	if err := os.Symlink(outside, filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err.Error())
+	}
+	for name, expected := range map[string]string{
+		filepath.ToSlash(filepath.Join(outside, "abs.go")): "absolute path",
+		"../outside/parent.go":                             "parent directory",
+		"sub/../../outside/nested.go":                      "parent directory",
+		"link/linked.go":                                   "outside of",
+	} {
+		runner.Fetcher = templateFetcher("package #! .Name !#\n#! define \"file:" + name + "\" !#package outside\n#! end !#")
+		err := runner.Run(context.Background(), []*Job{readerJob(filepath.Join(dir, "main.go"), "wrappers")})
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Fatalf("%s: expected %q but got %v", name, expected, err)
+		}
+	}
+	written, err := ioutil.ReadDir(outside)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(written) > 0 {
+		t.Fatalf("expected nothing to be written outside of the destination but found %s", written[0].Name())
+	}
+}
+
+func TestRunnerFilesPattern(t *testing.T) {
+	template := func(fileName string) TemplateFetcher {
+		return templateFetcher("package #! .Name !#\n#! define \"file:" + fileName + "\" !#package #! .Name !#\n\nvar _ #! (index .Interfaces 0).SrcType !##! end !#")
+	}
+	runner, root := newTestRunner(t, "")
+	job := func(destination string) *Job {
+		job := readerJob(filepath.Join(root, destination), "wrappers")
+		job.Interfaces = []string{"Reader", "Writer"}
+		return job
+	}
+
+	// Each interface of a destination pattern writes a file of its own.
+	runner.Fetcher = template("{{ .Interface.Name | snakecase }}_test.go")
+	if err := runner.Run(context.Background(), []*Job{job("{{ .Interface.Name | snakecase }}.go")}); err != nil {
+		t.Fatal(err.Error())
+	}
+	for name, expected := range map[string]string{"reader_test.go": "io.Reader", "writer_test.go": "io.Writer"} {
+		b, err := ioutil.ReadFile(filepath.Join(root, name))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !strings.Contains(string(b), expected) {
+			t.Errorf("%s: expected %q in\n%s", name, expected, string(b))
+		}
+	}
+
+	// A pattern needs a single interface.
+	err := runner.Run(context.Background(), []*Job{job("both.go")})
+	if err == nil || !strings.Contains(err.Error(), "requires a single interface") {
+		t.Fatalf("expected a pattern with more than one interface to fail but got %v", err)
+	}
+
+	// A file with the same name for every interface is rejected.
+	runner.Fetcher = template("fake_test.go")
+	err = runner.Run(context.Background(), []*Job{job("{{ .Interface.Name | snakecase }}.go")})
+	if err == nil || !strings.Contains(err.Error(), "for every interface of the destination pattern") {
+		t.Fatalf("expected a file that is the same for every interface to fail but got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "fake_test.go")); !os.IsNotExist(err) {
+		t.Fatal("expected the file not to be written")
+	}
+}
+
+func TestRunnerCheck(t *testing.T) {
+	runner, root := newTestRunner(t, "package #! .Name !#\n\nvar _ = []string{#! range .Interfaces !#\"#! .Name !#\",#! end !#}\n")
+	runner.Check = true
+	files := map[string]string{
+		// The same content as the output but formatted.
+		"current.go": "package first\r\n\r\nvar _ = []string{\"Reader\"}\r\n",
+		"stale.go":   "package first\n\nvar _ = []string{\"Writer\"}\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	job := func(dest string) *Job {
+		return readerJob(dest, "first")
+	}
+	if err := runner.Run(context.Background(), []*Job{job(filepath.Join(root, "current.go"))}); err != nil {
+		t.Fatalf("expected an up to date destination to pass: %v", err)
+	}
+	err := runner.Run(context.Background(), []*Job{
+		job(filepath.Join(root, "stale.go")),
+		job(filepath.Join(root, "missing.go")),
+		job(""),
+	})
+	if err == nil {
+		t.Fatal("expected stale destinations to fail")
+	}
+	for _, expected := range []string{"stale.go is out of date", "missing.go does not exist", "job 3 (", "destination file is required"} {
+		if !strings.Contains(err.Error(), expected) {
+			t.Fatalf("expected %q in %v", expected, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(root, "missing.go")); !os.IsNotExist(err) {
+		t.Fatal("check wrote a destination file")
+	}
+	b, _ := ioutil.ReadFile(filepath.Join(root, "stale.go"))
+	if string(b) != files["stale.go"] {
+		t.Fatal("check modified a destination file")
+	}
+}
+
+func TestRunnerCheckVersion(t *testing.T) {
+	runner, root := newTestRunner(t, "package #! .Name !#\n")
+	runner.NoHeader = false
+	dest := filepath.Join(root, "wrappers.go")
+	job := readerJob(dest, "wrappers")
+	if err := runner.Run(context.Background(), []*Job{job}); err != nil {
+		t.Fatal(err.Error())
+	}
+	b, err := ioutil.ReadFile(dest)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	current := versionPrefix + version() + "\n"
+	if !strings.Contains(string(b), current) {
+		t.Fatalf("expected the header to record the version: %s", b)
+	}
+	// A file generated by another version of wrapgen is not out of date.
+	other := strings.Replace(string(b), current, versionPrefix+"v2.0.0\n", 1)
+	if err := ioutil.WriteFile(dest, []byte(other), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	runner.Check = true
+	if err := runner.Run(context.Background(), []*Job{job}); err != nil {
+		t.Fatalf("expected a header with another version to pass: %v", err)
+	}
+	stale := strings.Replace(other, "// Source: io", "// Source: bufio", 1)
+	if err := ioutil.WriteFile(dest, []byte(stale), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := runner.Run(context.Background(), []*Job{job}); err == nil {
+		t.Fatal("expected a header with a different source to fail")
+	}
+}
+
+func TestRunnerDiff(t *testing.T) {
+	var stdout bytes.Buffer
+	runner, root := newTestRunner(t, "package #! .Name !#\n\nvar _ = \"#! index .Vars \"name\" !#\"\n")
+	runner.Stdout = &stdout
+	runner.Diff = true
+	current := "package first\n\nvar _ = \"current\"\n"
+	stale := "package first\n\nvar _ = \"stale\"\n"
+	for name, content := range map[string]string{"current.go": current, "stale.go": stale} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(content), 0644); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	job := func(dest string) *Job {
+		job := readerJob(filepath.Join(root, dest), "first")
+		job.Vars = map[string]string{"name": "current"}
+		return job
+	}
+	jobs := []*Job{job("stale.go"), job("current.go"), job("missing.go")}
+	if err := runner.Run(context.Background(), jobs); err != nil {
+		t.Fatal(err.Error())
+	}
+	expected := strings.Join([]string{
+		"--- " + filepath.Join(root, "stale.go"),
+		"+++ " + filepath.Join(root, "stale.go"),
+		"@@ -1,3 +1,3 @@",
+		" package first",
+		" ",
+		`-var _ = "stale"`,
+		`+var _ = "current"`,
+		"--- " + os.DevNull,
+		"+++ " + filepath.Join(root, "missing.go"),
+		"@@ -0,0 +1,3 @@",
+		"+package first",
+		"+",
+		`+var _ = "current"`,
+		"",
+	}, "\n")
+	if stdout.String() != expected {
+		t.Fatalf("expected\n%s\nbut got\n%s", expected, stdout.String())
+	}
+	if _, err := os.Stat(filepath.Join(root, "missing.go")); !os.IsNotExist(err) {
+		t.Fatal("diff wrote a destination file")
+	}
+
+	stdout.Reset()
+	runner.Check = true
+	if err := runner.Run(context.Background(), jobs); err == nil {
+		t.Fatal("expected check to fail when combined with diff")
+	}
+	if !strings.Contains(stdout.String(), `+var _ = "current"`) {
+		t.Fatalf("expected diffs when combined with check but got %s", stdout.String())
+	}
+}
+
+func TestRunnerSyntaxError(t *testing.T) {
+	var stdout bytes.Buffer
+	runner, _ := newTestRunner(t, "package #! .Name !#\n#! range .Interfaces !##! range .Methods !#\nfunc #! .Name !#( {}\n#! end !##! end !#")
+	runner.Stdout = &stdout
+	job := readerJob("", "wrappers")
+	job.Template = "templates/broken.txt"
+	err := runner.Run(context.Background(), []*Job{job})
+	if err == nil {
+		t.Fatal("expected a syntax error")
+	}
+	if !strings.Contains(err.Error(), "broken.txt:3 (method Read of io.Reader): ") {
+		t.Fatalf("expected the error to refer to the template but got %v", err)
+	}
+}
+
+// newTestRunner creates a Runner that renders the given template for every
+// job and leaves out the header, along with a temporary directory for its
+// output that is removed when the test ends.
+func newTestRunner(t *testing.T, template string) (*Runner, string) {
+	root, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() {
+		_ = os.RemoveAll(root)
+	})
+	return &Runner{Fetcher: templateFetcher(template), NoHeader: true}, root
+}
+
+// templateFetcher gives the same template for every path.
+func templateFetcher(template string) TemplateFetcher {
+	return &FSTemplateFetcher{ReadFn: func(path string) ([]byte, error) {
+		return []byte(template), nil
+	}}
+}
+
+// readerJob renders io.Reader into the destination with the template of the
+// test.
+func readerJob(destination string, pkg string) *Job {
+	return &Job{
+		Source:      "io",
+		Interfaces:  []string{"Reader"},
+		Template:    "template.txt",
+		Destination: destination,
+		Package:     pkg,
+	}
+}
@@ -0,0 +1,267 @@
+package wrapgen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+	"unicode"
+)
+
+// markFunc is the name of the template function that records the position of
+// the output when each node of a template is executed.
+const markFunc = "wrapgenMark"
+
+// sourceMap records which part of a template produced each part of the
+// output so that problems in the generated code can be reported in terms of
+// the template. Every node of the parsed template is preceded by a call to
+// markFunc which notes the length of the output, the node about to execute,
+// and the interface or method being rendered.
+type sourceMap struct {
+	name  string
+	text  string
+	out   *bytes.Buffer
+	nodes []parse.Node
+	marks []mark
+	// iface and method are the most recent interface and method that a node
+	// was executed with.
+	iface  *Interface
+	method *Method
+}
+
+type mark struct {
+	offset int
+	node   int
+	iface  *Interface
+	method *Method
+}
+
+// newSourceMap creates a map for a template with the given name and source
+// text.
+func newSourceMap(name string, text string) *sourceMap {
+	return &sourceMap{name: name, text: text}
+}
+
+// reset records the marks of the next execution of the template, which is
+// written to out. A map of the previous execution is returned so that the
+// template can be executed more than once.
+func (m *sourceMap) reset(out *bytes.Buffer) *sourceMap {
+	previous := *m
+	m.out, m.marks, m.iface, m.method = out, nil, nil, nil
+	return &previous
+}
+
+// insert accounts for text that is inserted into the output at the given
+// offset after the template is executed.
+func (m *sourceMap) insert(offset int, text []byte) {
+	out := m.out.Bytes()
+	content := make([]byte, 0, len(out)+len(text))
+	content = append(append(append(content, out[:offset]...), text...), out[offset:]...)
+	m.out = bytes.NewBuffer(content)
+	for x := range m.marks {
+		if m.marks[x].offset >= offset {
+			m.marks[x].offset = m.marks[x].offset + len(text)
+		}
+	}
+}
+
+// funcs returns the functions that must be installed in the template before
+// it is executed.
+func (m *sourceMap) funcs() template.FuncMap {
+	return template.FuncMap{markFunc: m.mark}
+}
+
+// instrument inserts a call to markFunc before every node of every template
+// associated with t.
+func (m *sourceMap) instrument(t *template.Template) {
+	for _, tmpl := range t.Templates() {
+		if tmpl.Tree != nil && tmpl.Tree.Root != nil {
+			m.instrumentList(tmpl.Tree, tmpl.Tree.Root)
+		}
+	}
+}
+
+func (m *sourceMap) instrumentList(tree *parse.Tree, list *parse.ListNode) {
+	if list == nil {
+		return
+	}
+	nodes := make([]parse.Node, 0, 2*len(list.Nodes))
+	for _, node := range list.Nodes {
+		switch n := node.(type) {
+		case *parse.IfNode:
+			m.instrumentList(tree, n.List)
+			m.instrumentList(tree, n.ElseList)
+		case *parse.RangeNode:
+			m.instrumentList(tree, n.List)
+			m.instrumentList(tree, n.ElseList)
+		case *parse.WithNode:
+			m.instrumentList(tree, n.List)
+			m.instrumentList(tree, n.ElseList)
+		}
+		nodes = append(nodes, m.markNode(tree, node), node)
+	}
+	list.Nodes = nodes
+}
+
+// markNode creates the equivalent of {{wrapgenMark N .}} where N identifies
+// the given node.
+func (m *sourceMap) markNode(tree *parse.Tree, node parse.Node) parse.Node {
+	id := len(m.nodes)
+	m.nodes = append(m.nodes, node)
+	pos := node.Position()
+	return &parse.ActionNode{
+		NodeType: parse.NodeAction,
+		Pos:      pos,
+		Pipe: &parse.PipeNode{
+			NodeType: parse.NodePipe,
+			Pos:      pos,
+			Cmds: []*parse.CommandNode{{
+				NodeType: parse.NodeCommand,
+				Pos:      pos,
+				Args: []parse.Node{
+					parse.NewIdentifier(markFunc).SetTree(tree).SetPos(pos),
+					&parse.NumberNode{
+						NodeType: parse.NodeNumber,
+						Pos:      pos,
+						IsInt:    true,
+						Int64:    int64(id),
+						Text:     fmt.Sprint(id),
+					},
+					&parse.DotNode{NodeType: parse.NodeDot, Pos: pos},
+				},
+			}},
+		},
+	}
+}
+
+func (m *sourceMap) mark(id int, dot interface{}) string {
+	switch d := dot.(type) {
+	case *Package:
+		m.iface, m.method = nil, nil
+	case *Interface:
+		m.iface, m.method = d, nil
+	case *Method:
+		m.method = d
+	}
+	m.marks = append(m.marks, mark{
+		offset: m.out.Len(),
+		node:   id,
+		iface:  m.iface,
+		method: m.method,
+	})
+	return ""
+}
+
+// locate describes the part of the template that produced the given line and
+// column of the output. For example, "logtime.txt:17 (method Read of
+// io.Reader)". The result is empty if the position is unknown.
+func (m *sourceMap) locate(src []byte, line int, column int) string {
+	offset := lineOffset(src, line)
+	if line < 1 || offset < 0 {
+		return ""
+	}
+	offset = offset + maxInt(column-1, 0)
+	// The marks are in order of their offsets. The last mark at or before the
+	// position is the node that produced it.
+	found := sort.Search(len(m.marks), func(i int) bool {
+		return m.marks[i].offset > offset
+	}) - 1
+	if found < 0 {
+		return ""
+	}
+	mk := m.marks[found]
+	node := m.nodes[mk.node]
+	templateLine := 1 + strings.Count(m.text[:int(node.Position())], "\n")
+	if _, ok := node.(*parse.TextNode); ok && offset <= len(src) && mk.offset <= offset {
+		// Text is copied to the output as is so the line within the text
+		// that produced the position can be found exactly.
+		templateLine = templateLine + bytes.Count(src[mk.offset:offset], []byte("\n"))
+	}
+	result := fmt.Sprintf("%s:%d", m.name, templateLine)
+	switch {
+	case mk.method != nil && mk.iface != nil:
+		result = fmt.Sprintf("%s (method %s of %s)", result, mk.method.Name, mk.iface.SrcType)
+	case mk.method != nil:
+		result = fmt.Sprintf("%s (method %s)", result, mk.method.Name)
+	case mk.iface != nil:
+		result = fmt.Sprintf("%s (interface %s)", result, mk.iface.SrcType)
+	}
+	return result
+}
+
+// locateOutput is the same as locate except that the position is within a
+// formatted copy of the output. Formatting mostly changes the spaces within
+// lines so each formatted line is matched to the output line that has the same
+// content once spaces are removed.
+func (m *sourceMap) locateOutput(formatted []byte, line int, column int) string {
+	raw := m.out.Bytes()
+	if bytes.Equal(raw, formatted) {
+		return m.locate(raw, line, column)
+	}
+	rawLines := strings.Split(string(raw), "\n")
+	formattedLines := strings.Split(string(formatted), "\n")
+	if line < 1 || line > len(formattedLines) {
+		return ""
+	}
+	rawLine := -1
+	for _, e := range diffLines(stripSpaces(rawLines), stripSpaces(formattedLines)) {
+		if e.kind == ' ' && e.b == line-1 {
+			rawLine = e.a
+			break
+		}
+	}
+	if rawLine < 0 {
+		return ""
+	}
+	// The column is moved past the same number of non-space characters in
+	// the output line as precede it in the formatted line.
+	target := formattedLines[line-1]
+	visible := 0
+	for offset, r := range target {
+		if offset >= column-1 {
+			break
+		}
+		if !unicode.IsSpace(r) {
+			visible = visible + 1
+		}
+	}
+	rawColumn := 1
+	for offset, r := range rawLines[rawLine] {
+		rawColumn = offset + 1
+		if !unicode.IsSpace(r) {
+			if visible == 0 {
+				break
+			}
+			visible = visible - 1
+		}
+	}
+	return m.locate(raw, rawLine+1, rawColumn)
+}
+
+func stripSpaces(lines []string) []string {
+	result := make([]string, len(lines))
+	for offset, line := range lines {
+		result[offset] = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+	}
+	return result
+}
+
+// lineOffset returns the offset of the first byte of a one based line number.
+func lineOffset(src []byte, line int) int {
+	offset := 0
+	for current := 1; current < line; current = current + 1 {
+		next := bytes.IndexByte(src[offset:], '\n')
+		if next < 0 {
+			return -1
+		}
+		offset = offset + next + 1
+	}
+	return offset
+}
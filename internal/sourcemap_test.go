@@ -0,0 +1,97 @@
+package wrapgen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestSourceMap(t *testing.T) {
+	text := strings.Join([]string{
+		"package #! .Name !#",
+		"#! range .Interfaces !#",
+		"type Wraps#! .Name !# struct{}",
+		"#! range .Methods !#",
+		"func (w *Wraps) #! .Name !#() {",
+		"\treturn",
+		"}",
+		"#! end !##! end !#",
+		"#! define \"footer\" !#// #! .Name !#",
+		"#! end !##! template \"footer\" . !#",
+		"",
+	}, "\n")
+	pkg := &Package{
+		Name: "wrappers",
+		Interfaces: []*Interface{
+			{
+				Name:    "Reader",
+				SrcType: &TypeExported{Package: "io", Type: TypeBuiltin("Reader")},
+				Methods: []*Method{{Name: "Read"}},
+			},
+			{
+				Name:    "Writer",
+				SrcType: &TypeExported{Package: "io", Type: TypeBuiltin("Writer")},
+				Methods: []*Method{{Name: "Write"}},
+			},
+		},
+	}
+	var buff bytes.Buffer
+	smap := newSourceMap("test.txt", text)
+	tmpl, err := NewTemplate("", "").Funcs(smap.funcs()).Parse(text)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	smap.instrument(tmpl)
+	smap.reset(&buff)
+	if err := tmpl.Execute(&buff, pkg); err != nil {
+		t.Fatal(err.Error())
+	}
+	src := buff.Bytes()
+	expected := strings.Join([]string{
+		"package wrappers",
+		"",
+		"type WrapsReader struct{}",
+		"",
+		"func (w *Wraps) Read() {",
+		"\treturn",
+		"}",
+		"",
+		"type WrapsWriter struct{}",
+		"",
+		"func (w *Wraps) Write() {",
+		"\treturn",
+		"}",
+		"",
+		"// wrappers",
+		"",
+		"",
+	}, "\n")
+	if string(src) != expected {
+		t.Fatalf("instrumenting changed the output:\n%q", src)
+	}
+
+	testCases := []struct {
+		line     int
+		column   int
+		expected string
+	}{
+		{line: 1, column: 1, expected: "test.txt:1"},
+		{line: 1, column: 9, expected: "test.txt:1"},
+		{line: 3, column: 6, expected: "test.txt:3 (interface io.Reader)"},
+		{line: 5, column: 17, expected: "test.txt:5 (method Read of io.Reader)"},
+		{line: 6, column: 2, expected: "test.txt:6 (method Read of io.Reader)"},
+		{line: 7, column: 1, expected: "test.txt:7 (method Read of io.Reader)"},
+		{line: 9, column: 1, expected: "test.txt:3 (interface io.Writer)"},
+		{line: 12, column: 2, expected: "test.txt:6 (method Write of io.Writer)"},
+		{line: 15, column: 1, expected: "test.txt:9"},
+		{line: 15, column: 4, expected: "test.txt:9"},
+	}
+	for _, testCase := range testCases {
+		if result := smap.locate(src, testCase.line, testCase.column); result != testCase.expected {
+			t.Errorf("%d:%d expected %q but got %q", testCase.line, testCase.column, testCase.expected, result)
+		}
+	}
+	if result := smap.locate(src, 100, 1); result != "" {
+		t.Errorf("expected no location past the end but got %q", result)
+	}
+}
@@ -5,50 +5,378 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"io/ioutil"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/kevinconway/wrapgen/v2/templates"
 )
 
+// DefaultMaxTemplateBytes is the largest template that HTTPTemplateFetcher
+// downloads unless it is configured otherwise.
+const DefaultMaxTemplateBytes = 1 << 20
+
+// defaultBackoff is the delay before the first retry of a request unless
+// HTTPTemplateFetcher is configured otherwise.
+const defaultBackoff = 500 * time.Millisecond
+
+// defaultMaxBackoff is the longest delay before a retry unless
+// HTTPTemplateFetcher is configured otherwise.
+const defaultMaxBackoff = 30 * time.Second
+
+// maxErrorBody is the most of a response that is included in an error.
+const maxErrorBody = 200
+
 // HTTPTemplateFetcher treats any given path as a URL and attempts
 // to download the content via a GET.
 type HTTPTemplateFetcher struct {
 	Client *http.Client
+	// CacheDir keeps a copy of every downloaded template. Cached templates
+	// are revalidated with the origin rather than downloaded again and are
+	// used when the origin cannot be reached. Nothing is cached if it is
+	// empty.
+	CacheDir string
+	// Offline forbids network access so that only cached templates can be
+	// fetched.
+	Offline bool
+	// MaxBytes is the largest template that is downloaded. Defaults to
+	// DefaultMaxTemplateBytes.
+	MaxBytes int64
+	// AllowedHosts limits templates, and any redirects followed while
+	// fetching them, to the given host names. Any host is allowed if it is
+	// empty.
+	AllowedHosts []string
+	// Timeout limits each request regardless of the deadline of the context.
+	// Requests are only limited by the context if it is zero.
+	Timeout time.Duration
+	// Retries is the number of times that a request which fails with a 5xx
+	// or 429 status is repeated.
+	Retries int
+	// Backoff is the delay before the first retry, which doubles for each
+	// retry after it. A Retry-After header from the origin takes precedence.
+	// Defaults to half a second.
+	Backoff time.Duration
+	// MaxBackoff is the longest delay before a retry. A request fails rather
+	// than being retried if a Retry-After header asks for a longer delay.
+	// Defaults to 30 seconds.
+	MaxBackoff time.Duration
+}
+
+// policyError reports a response that the fetcher refuses to use. A cached
+// template is never used in place of a refused response.
+type policyError struct {
+	error
+}
+
+func (e policyError) Unwrap() error {
+	return e.error
 }
 
 // FetchTemplate attempts to load via GET.
 func (f *HTTPTemplateFetcher) FetchTemplate(ctx context.Context, path string) (string, error) {
-	if !strings.Contains(path, "://") {
-		return "", fmt.Errorf("path %s contains no protocol such as http:// or https://", path)
+	u, err := url.Parse(path)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return "", fmt.Errorf("path %s is not a URL such as https://example.com/template.txt", path)
 	}
-	req, _ := http.NewRequest(http.MethodGet, path, http.NoBody)
-	resp, err := f.Client.Do(req.WithContext(ctx))
-	if err != nil {
+	if err := f.allowed(u); err != nil {
 		return "", err
 	}
+	cache := httpCache(f.CacheDir)
+	cached := cache.load(path)
+	if f.Offline {
+		if cached == nil {
+			return "", fmt.Errorf("template %s is not cached and network access is disabled", path)
+		}
+		return cached.Body, nil
+	}
+	var (
+		resp *http.Response
+		body string
+	)
+	for attempt := 0; ; attempt++ {
+		resp, body, err = f.get(ctx, path, cached)
+		if err != nil {
+			var policy policyError
+			if cached != nil && ctx.Err() == nil && !errors.As(err, &policy) {
+				return cached.Body, nil
+			}
+			return "", err
+		}
+		if !retryable(resp.StatusCode) || attempt >= f.Retries {
+			break
+		}
+		wait, err := f.delay(attempt, resp)
+		if err != nil {
+			if cached != nil {
+				return cached.Body, nil
+			}
+			return "", fmt.Errorf("%d fetching template: %v", resp.StatusCode, err)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return "", ctx.Err()
+		case <-timer.C:
+		}
+	}
+	if resp.StatusCode == http.StatusNotModified && cached != nil {
+		return cached.Body, nil
+	}
+	if retryable(resp.StatusCode) && cached != nil {
+		return cached.Body, nil
+	}
+	if resp.StatusCode > 300 || resp.StatusCode < 200 {
+		return "", fmt.Errorf("%d fetching template: %v", resp.StatusCode, errors.New(truncate(body, maxErrorBody)))
+	}
+	if err := checkContentType(resp.Header.Get("Content-Type")); err != nil {
+		return "", fmt.Errorf("template %s: %v", path, err)
+	}
+	cache.store(path, resp, body)
+	return body, nil
+}
+
+// get makes a single request for a template. The body of the response is
+// read before returning.
+func (f *HTTPTemplateFetcher) get(ctx context.Context, path string, cached *cachedTemplate) (*http.Response, string, error) {
+	if f.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, f.Timeout)
+		defer cancel()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, path, http.NoBody)
+	if err != nil {
+		return nil, "", err
+	}
+	if cached != nil {
+		if cached.ETag != "" {
+			req.Header.Set("If-None-Match", cached.ETag)
+		}
+		if cached.LastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.LastModified)
+		}
+	}
+	resp, err := f.client().Do(req)
+	if err != nil {
+		return nil, "", err
+	}
 	defer resp.Body.Close()
-	b, err := ioutil.ReadAll(resp.Body)
+	limit := f.MaxBytes
+	if limit <= 0 {
+		limit = DefaultMaxTemplateBytes
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(resp.Body, limit+1))
 	if err != nil {
-		return "", err
+		return nil, "", err
 	}
-	if resp.StatusCode > 300 || resp.StatusCode < 200 {
-		return "", fmt.Errorf("%d fetching template: %v", resp.StatusCode, errors.New(string(b)))
+	if int64(len(b)) > limit {
+		return nil, "", policyError{fmt.Errorf("template %s is larger than %d bytes", path, limit)}
+	}
+	return resp, string(b), nil
+}
+
+// client copies the configured client with a redirect policy that applies
+// the allowed hosts and refuses to downgrade from https to http.
+func (f *HTTPTemplateFetcher) client() *http.Client {
+	client := http.DefaultClient
+	if f.Client != nil {
+		client = f.Client
+	}
+	result := *client
+	next := client.CheckRedirect
+	result.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		if via[len(via)-1].URL.Scheme == "https" && req.URL.Scheme != "https" {
+			return policyError{fmt.Errorf("refusing redirect from %s to %s", via[len(via)-1].URL, req.URL)}
+		}
+		if err := f.allowed(req.URL); err != nil {
+			return err
+		}
+		if next != nil {
+			return next(req, via)
+		}
+		if len(via) >= 10 {
+			return errors.New("stopped after 10 redirects")
+		}
+		return nil
+	}
+	return &result
+}
+
+// allowed checks the host of a URL against AllowedHosts.
+func (f *HTTPTemplateFetcher) allowed(u *url.URL) error {
+	if len(f.AllowedHosts) < 1 {
+		return nil
+	}
+	for _, host := range f.AllowedHosts {
+		if strings.EqualFold(host, u.Hostname()) {
+			return nil
+		}
+	}
+	return policyError{fmt.Errorf("host %s is not allowed: allowed hosts are %s", u.Hostname(), strings.Join(f.AllowedHosts, ", "))}
+}
+
+// delay returns how long to wait before retrying a request. The delay is
+// limited by MaxBackoff and an error is returned if the origin asks for a
+// longer one.
+func (f *HTTPTemplateFetcher) delay(attempt int, resp *http.Response) (time.Duration, error) {
+	limit := f.MaxBackoff
+	if limit <= 0 {
+		limit = defaultMaxBackoff
+	}
+	if seconds, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && seconds >= 0 {
+		if int64(seconds) > int64(limit/time.Second) {
+			return 0, fmt.Errorf("the server asked to retry after %d seconds which is longer than %s", seconds, limit)
+		}
+		return time.Duration(seconds) * time.Second, nil
+	}
+	backoff := f.Backoff
+	if backoff <= 0 {
+		backoff = defaultBackoff
+	}
+	for x := 0; x < attempt && backoff < limit; x = x + 1 {
+		backoff = backoff * 2
 	}
-	return string(b), nil
+	if backoff > limit {
+		return limit, nil
+	}
+	return backoff, nil
+}
+
+// retryable reports whether a request that failed with the status may succeed
+// if it is repeated.
+func retryable(status int) bool {
+	return status >= 500 || status == http.StatusTooManyRequests
+}
+
+// checkContentType accepts the content types that a template may be served
+// with. A missing content type is accepted because many servers leave it out
+// for unknown extensions.
+func checkContentType(contentType string) error {
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q: %v", contentType, err)
+	}
+	switch {
+	case mediaType == "text/html":
+	case strings.HasPrefix(mediaType, "text/"), mediaType == "application/octet-stream":
+		return nil
+	}
+	return fmt.Errorf("unexpected content type %s", mediaType)
+}
+
+// truncate shortens text, such as an error page, for use in an error message.
+// Runs of whitespace are collapsed.
+func truncate(text string, max int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if len(text) <= max {
+		return text
+	}
+	for max > 0 && !utf8.RuneStart(text[max]) {
+		max--
+	}
+	return text[:max] + "..."
 }
 
 // FSTemplateFetcher treats any given path as existing on the file system
-// and attempts to open the file.
+// and attempts to open the file. Paths may also be given as file:// URLs.
 type FSTemplateFetcher struct {
 	ReadFn func(string) ([]byte, error)
 }
 
 // FetchTemplate attempts to load from the file system.
 func (f *FSTemplateFetcher) FetchTemplate(ctx context.Context, path string) (string, error) {
+	if templateScheme(path) == "file" {
+		path = filepath.FromSlash(strings.TrimPrefix(path[len("file:"):], "//"))
+	}
 	b, err := f.ReadFn(path)
 	return string(b), err
 }
 
+// BuiltinPrefix begins the path of a template that is built into wrapgen, such
+// as builtin:logtime.
+const BuiltinPrefix = "builtin:"
+
+// isLocalPath reports whether a template path refers to the file system
+// rather than a URL, a built in template, or standard input.
+func isLocalPath(path string) bool {
+	return templateScheme(path) == ""
+}
+
+// BuiltinTemplate describes a template that is built into wrapgen.
+type BuiltinTemplate struct {
+	Name        string
+	Description string
+}
+
+// BuiltinTemplateFetcher loads the templates that are built into wrapgen.
+type BuiltinTemplateFetcher struct {
+	// FS holds a .txt file for each template. The templates embedded in
+	// wrapgen are used if it is nil.
+	FS fs.FS
+}
+
+func (f *BuiltinTemplateFetcher) fs() fs.FS {
+	if f.FS == nil {
+		return templates.FS
+	}
+	return f.FS
+}
+
+// FetchTemplate loads a built in template from a path such as builtin:logtime.
+func (f *BuiltinTemplateFetcher) FetchTemplate(ctx context.Context, path string) (string, error) {
+	if !strings.HasPrefix(path, BuiltinPrefix) {
+		return "", fmt.Errorf("path %s does not name a builtin template such as %slogtime", path, BuiltinPrefix)
+	}
+	name := strings.TrimPrefix(path, BuiltinPrefix)
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", fmt.Errorf("invalid builtin template name %q", name)
+	}
+	b, err := fs.ReadFile(f.fs(), name+".txt")
+	if errors.Is(err, fs.ErrNotExist) {
+		list, _ := f.Templates()
+		names := make([]string, 0, len(list))
+		for _, t := range list {
+			names = append(names, t.Name)
+		}
+		return "", fmt.Errorf("no builtin template named %s, choose one of %s", name, strings.Join(names, ", "))
+	}
+	return string(b), err
+}
+
+// Templates lists the built in templates in order of their names.
+func (f *BuiltinTemplateFetcher) Templates() ([]BuiltinTemplate, error) {
+	matches, err := fs.Glob(f.fs(), "*.txt")
+	if err != nil {
+		return nil, err
+	}
+	result := make([]BuiltinTemplate, 0, len(matches))
+	for _, match := range matches {
+		name := strings.TrimSuffix(path.Base(match), ".txt")
+		result = append(result, BuiltinTemplate{
+			Name:        name,
+			Description: templates.Descriptions[name],
+		})
+	}
+	sort.Slice(result, func(i int, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
 type multiError []error
 
 func (e multiError) Error() string {
@@ -60,22 +388,97 @@ func (e multiError) Error() string {
 	return buf.String()
 }
 
-// MultiTemplateFetcher takes an ordered set of TemplateFetcher instances an
-// attempts to call each one until a response if received or all fail.
-type MultiTemplateFetcher []TemplateFetcher
+// StdinPath is the template path that reads the template from standard input.
+const StdinPath = "-"
 
-func (f MultiTemplateFetcher) FetchTemplate(ctx context.Context, path string) (string, error) {
-	var errs []error
-	for _, fetcher := range f {
-		r, err := fetcher.FetchTemplate(ctx, path)
-		if err != nil {
-			errs = append(errs, err)
-			continue
+// templateScheme returns the scheme of a template path such as http for
+// http://example.com/t.txt or builtin for builtin:logtime. Paths on the file
+// system have no scheme and standard input has the scheme StdinPath. A
+// single letter before a colon is a Windows drive rather than a scheme.
+func templateScheme(path string) string {
+	if path == StdinPath {
+		return StdinPath
+	}
+	offset := strings.Index(path, ":")
+	if offset < 2 {
+		return ""
+	}
+	for x, r := range path[:offset] {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z':
+		case x > 0 && (r >= '0' && r <= '9' || r == '+' || r == '-' || r == '.'):
+		default:
+			return ""
+		}
+	}
+	return strings.ToLower(path[:offset])
+}
+
+// SchemeTemplateFetcher dispatches each path to the one TemplateFetcher that
+// is registered for its scheme. The zero value has no fetchers registered.
+type SchemeTemplateFetcher struct {
+	fetchers map[string]TemplateFetcher
+}
+
+// Register installs the fetcher for paths with the given scheme, replacing any
+// fetcher already registered for it. The scheme is given without a colon, as
+// an empty string for paths on the file system, or as StdinPath. Fetchers must
+// be registered before any template is fetched.
+func (f *SchemeTemplateFetcher) Register(scheme string, fetcher TemplateFetcher) {
+	if f.fetchers == nil {
+		f.fetchers = make(map[string]TemplateFetcher)
+	}
+	f.fetchers[strings.ToLower(scheme)] = fetcher
+}
+
+// Lookup returns the fetcher registered for a scheme or nil if there is none.
+func (f *SchemeTemplateFetcher) Lookup(scheme string) TemplateFetcher {
+	return f.fetchers[strings.ToLower(scheme)]
+}
+
+// FetchTemplate loads the template with the fetcher registered for the scheme
+// of the path.
+func (f *SchemeTemplateFetcher) FetchTemplate(ctx context.Context, path string) (string, error) {
+	scheme := templateScheme(path)
+	fetcher, ok := f.fetchers[scheme]
+	if !ok {
+		if scheme == "" {
+			return "", fmt.Errorf("template %s is a file but no fetcher is registered for files", path)
 		}
-		return r, nil
+		schemes := make([]string, 0, len(f.fetchers))
+		for name := range f.fetchers {
+			if name != "" && name != StdinPath {
+				schemes = append(schemes, name+":")
+			}
+		}
+		sort.Strings(schemes)
+		return "", fmt.Errorf("template %s has unsupported scheme %s: supported schemes are %s", path, scheme, strings.Join(schemes, ", "))
 	}
-	if len(errs) == 0 {
-		return "", fmt.Errorf("no fetchers found for path %s", path)
+	return fetcher.FetchTemplate(ctx, path)
+}
+
+// StdinTemplateFetcher reads the template from a reader, usually standard
+// input. The reader is consumed by the first fetch and every later fetch
+// gives the same template.
+type StdinTemplateFetcher struct {
+	Reader io.Reader
+	once   sync.Once
+	text   string
+	err    error
+}
+
+// FetchTemplate reads the template from the reader.
+func (f *StdinTemplateFetcher) FetchTemplate(ctx context.Context, path string) (string, error) {
+	if path != StdinPath {
+		return "", fmt.Errorf("path %s is not %s", path, StdinPath)
 	}
-	return "", multiError(errs)
+	f.once.Do(func() {
+		b, err := ioutil.ReadAll(f.Reader)
+		if err != nil {
+			f.err = fmt.Errorf("failed to read template from standard input: %v", err)
+			return
+		}
+		f.text = string(b)
+	})
+	return f.text, f.err
 }
@@ -6,8 +6,14 @@ import (
 	"errors"
 	"io/ioutil"
 	http "net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
 	"strings"
+	"sync/atomic"
 	"testing"
+	"testing/fstest"
+	"time"
 
 	gomock "github.com/golang/mock/gomock"
 )
@@ -52,6 +58,157 @@ func TestHTTPTemplateFetcher(t *testing.T) {
 	}
 }
 
+func TestHTTPTemplateFetcherSafeguards(t *testing.T) {
+	var failures int32
+	mux := http.NewServeMux()
+	mux.HandleFunc("/t.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("i am template"))
+	})
+	mux.HandleFunc("/large.txt", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(bytes.Repeat([]byte("a"), 100))
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		_, _ = w.Write([]byte("<html>i am not a template</html>"))
+	})
+	mux.HandleFunc("/error.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(strings.Repeat("not found\n\n", 100)))
+	})
+	mux.HandleFunc("/slow.txt", func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second):
+		}
+	})
+	mux.HandleFunc("/flaky.txt", func(w http.ResponseWriter, r *http.Request) {
+		switch atomic.AddInt32(&failures, 1) {
+		case 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case 2:
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			_, _ = w.Write([]byte("i am template"))
+		}
+	})
+	mux.HandleFunc("/busy.txt", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", "3600")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	secure := httptest.NewTLSServer(http.RedirectHandler(server.URL+"/t.txt", http.StatusFound))
+	defer secure.Close()
+
+	ctx := context.Background()
+	fetcher := &HTTPTemplateFetcher{Client: secure.Client(), MaxBytes: 50, Timeout: 50 * time.Millisecond}
+	tmpl, err := fetcher.FetchTemplate(ctx, server.URL+"/t.txt")
+	if err != nil {
+		t.Fatalf("http did not fetch: %v", err)
+	}
+	if tmpl != "i am template" {
+		t.Fatalf("http fetched wrong template: %s", tmpl)
+	}
+	for _, path := range []string{"/large.txt", "/page.html", "/slow.txt", "/flaky.txt"} {
+		if _, err := fetcher.FetchTemplate(ctx, server.URL+path); err == nil {
+			t.Fatalf("http fetched %s", path)
+		}
+	}
+	if _, err := fetcher.FetchTemplate(ctx, secure.URL); err == nil || !strings.Contains(err.Error(), "refusing redirect") {
+		t.Fatalf("http followed a redirect from https to http: %v", err)
+	}
+	_, err = fetcher.FetchTemplate(ctx, server.URL+"/error.txt")
+	if err == nil {
+		t.Fatal("http masked a status code error")
+	}
+	if len(err.Error()) > 2*maxErrorBody || strings.Contains(err.Error(), "\n") {
+		t.Fatalf("http did not truncate the error: %q", err.Error())
+	}
+
+	fetcher = &HTTPTemplateFetcher{Client: server.Client(), Retries: 2, Backoff: time.Millisecond}
+	atomic.StoreInt32(&failures, 0)
+	tmpl, err = fetcher.FetchTemplate(ctx, server.URL+"/flaky.txt")
+	if err != nil {
+		t.Fatalf("http did not retry: %v", err)
+	}
+	if tmpl != "i am template" {
+		t.Fatalf("http fetched wrong template: %s", tmpl)
+	}
+
+	// A server that asks for a long delay fails the request rather than
+	// holding it up.
+	start := time.Now()
+	_, err = fetcher.FetchTemplate(ctx, server.URL+"/busy.txt")
+	if err == nil || !strings.Contains(err.Error(), "longer than 30s") {
+		t.Fatalf("http waited for a long retry: %v", err)
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Fatal("http slept before failing")
+	}
+
+	fetcher = &HTTPTemplateFetcher{Client: server.Client(), AllowedHosts: []string{"example.com"}}
+	if _, err := fetcher.FetchTemplate(ctx, server.URL+"/t.txt"); err == nil {
+		t.Fatal("http fetched from a host that is not allowed")
+	}
+	fetcher.AllowedHosts = []string{"127.0.0.1"}
+	if _, err := fetcher.FetchTemplate(ctx, server.URL+"/t.txt"); err != nil {
+		t.Fatalf("http did not fetch from an allowed host: %v", err)
+	}
+}
+
+func TestHTTPTemplateFetcherDelay(t *testing.T) {
+	fetcher := &HTTPTemplateFetcher{Backoff: time.Second, MaxBackoff: 5 * time.Second}
+	for attempt, expected := range map[int]time.Duration{
+		0:  time.Second,
+		2:  4 * time.Second,
+		3:  5 * time.Second,
+		80: 5 * time.Second,
+	} {
+		delay, err := fetcher.delay(attempt, &http.Response{Header: http.Header{}})
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if delay != expected {
+			t.Fatalf("attempt %d: expected a delay of %s but got %s", attempt, expected, delay)
+		}
+	}
+	retryAfter := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": []string{value}}}
+	}
+	delay, err := fetcher.delay(0, retryAfter("5"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if delay != 5*time.Second {
+		t.Fatalf("expected the delay from the server but got %s", delay)
+	}
+	if _, err := fetcher.delay(0, retryAfter("6")); err == nil {
+		t.Fatal("accepted a delay longer than the limit")
+	}
+	fetcher.MaxBackoff = 0
+	if _, err := fetcher.delay(0, retryAfter("31")); err == nil {
+		t.Fatal("accepted a delay longer than the default limit")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	for _, testCase := range []struct {
+		text     string
+		expected string
+	}{
+		{"short", "short"},
+		{"  a\n\tb  ", "a b"},
+		{"abcdefgh", "abcde..."},
+		{"abcdé", "abcd..."},
+	} {
+		if result := truncate(testCase.text, 5); result != testCase.expected {
+			t.Fatalf("expected %q but got %q", testCase.expected, result)
+		}
+	}
+}
+
 func TestFSTemplateFetcher(t *testing.T) {
 	fetcher := &FSTemplateFetcher{ReadFn: func(string) ([]byte, error) {
 		return nil, errors.New("failure")
@@ -70,38 +227,161 @@ func TestFSTemplateFetcher(t *testing.T) {
 	if tmpl != "i am template" {
 		t.Fatalf("fs fetched wrong template: %s", tmpl)
 	}
+
+	var read []string
+	fetcher = &FSTemplateFetcher{ReadFn: func(path string) ([]byte, error) {
+		read = append(read, path)
+		return nil, nil
+	}}
+	for _, path := range []string{"file:///tmp/t.txt", "file://t.txt", "FILE:t.txt"} {
+		if _, err := fetcher.FetchTemplate(context.Background(), path); err != nil {
+			t.Fatalf("fs did not fetch %s: %v", path, err)
+		}
+	}
+	expected := []string{filepath.FromSlash("/tmp/t.txt"), "t.txt", "t.txt"}
+	if !reflect.DeepEqual(read, expected) {
+		t.Fatalf("fs read %v rather than %v", read, expected)
+	}
 }
 
-func TestMultiTemplateFetcher(t *testing.T) {
+func TestTemplateScheme(t *testing.T) {
+	for path, expected := range map[string]string{
+		"t.txt":                       "",
+		"templates/t.txt":             "",
+		"/tmp/t.txt":                  "",
+		`C:\templates\t.txt`:          "",
+		"templates/a:b.txt":           "",
+		"-":                           StdinPath,
+		"-t.txt":                      "",
+		"file:///tmp/t.txt":           "file",
+		"https://example.com/t.txt":   "https",
+		"HTTP://example.com/t.txt":    "http",
+		"builtin:logtime":             "builtin",
+		"git+ssh://example.com/t.txt": "git+ssh",
+	} {
+		if scheme := templateScheme(path); scheme != expected {
+			t.Fatalf("expected scheme %q for %s but got %q", expected, path, scheme)
+		}
+	}
+}
+
+func TestSchemeTemplateFetcher(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
+	ctx := context.Background()
+	files := NewMockTemplateFetcher(ctrl)
+	web := NewMockTemplateFetcher(ctrl)
+	stdin := NewMockTemplateFetcher(ctrl)
+	fetcher := &SchemeTemplateFetcher{}
+	fetcher.Register("", files)
+	fetcher.Register("HTTPS", web)
+	fetcher.Register(StdinPath, stdin)
+
+	files.EXPECT().FetchTemplate(gomock.Any(), "t.txt").Return("file template", nil)
+	web.EXPECT().FetchTemplate(gomock.Any(), "https://localhost/t.txt").Return("web template", nil)
+	stdin.EXPECT().FetchTemplate(gomock.Any(), "-").Return("stdin template", nil)
+	for path, expected := range map[string]string{
+		"t.txt":                   "file template",
+		"https://localhost/t.txt": "web template",
+		"-":                       "stdin template",
+	} {
+		tmpl, err := fetcher.FetchTemplate(ctx, path)
+		if err != nil {
+			t.Fatalf("scheme fetcher did not fetch %s: %v", path, err)
+		}
+		if tmpl != expected {
+			t.Fatalf("scheme fetcher fetched wrong template for %s: %s", path, tmpl)
+		}
+	}
+
 	ferr := errors.New("failure")
-	f1 := NewMockTemplateFetcher(ctrl)
-	f2 := NewMockTemplateFetcher(ctrl)
-	f3 := NewMockTemplateFetcher(ctrl)
-	fetcher := MultiTemplateFetcher{f1, f2, f3}
-
-	f1.EXPECT().FetchTemplate(gomock.Any(), gomock.Any()).Return("", ferr)
-	f2.EXPECT().FetchTemplate(gomock.Any(), gomock.Any()).Return("", ferr)
-	f3.EXPECT().FetchTemplate(gomock.Any(), gomock.Any()).Return("", ferr)
-	if _, err := fetcher.FetchTemplate(context.Background(), "template.txt"); err == nil {
-		t.Fatal("multi fetcher masked underlying errors")
+	files.EXPECT().FetchTemplate(gomock.Any(), "missing.txt").Return("", ferr)
+	if _, err := fetcher.FetchTemplate(ctx, "missing.txt"); err != ferr {
+		t.Fatalf("scheme fetcher did not return the error of the fetcher: %v", err)
 	}
 
-	f1.EXPECT().FetchTemplate(gomock.Any(), gomock.Any()).Return("", ferr)
-	f2.EXPECT().FetchTemplate(gomock.Any(), gomock.Any()).Return("", ferr)
-	f3.EXPECT().FetchTemplate(gomock.Any(), gomock.Any()).Return("i am template", nil)
-	tmpl, err := fetcher.FetchTemplate(context.Background(), "template.txt")
+	_, err := fetcher.FetchTemplate(ctx, "builtin:logtime")
+	if err == nil {
+		t.Fatal("scheme fetcher fetched an unregistered scheme")
+	}
+	if !strings.Contains(err.Error(), "unsupported scheme builtin: supported schemes are https:") {
+		t.Fatalf("scheme fetcher gave an imprecise error: %v", err)
+	}
+
+	if _, err := (&SchemeTemplateFetcher{}).FetchTemplate(ctx, "t.txt"); err == nil {
+		t.Fatal("scheme fetcher tried to work without any fetcher installed")
+	}
+}
+
+func TestStdinTemplateFetcher(t *testing.T) {
+	ctx := context.Background()
+	fetcher := &StdinTemplateFetcher{Reader: bytes.NewBufferString("i am template")}
+	if _, err := fetcher.FetchTemplate(ctx, "t.txt"); err == nil {
+		t.Fatal("stdin fetched a path other than -")
+	}
+	for x := 0; x < 2; x++ {
+		tmpl, err := fetcher.FetchTemplate(ctx, StdinPath)
+		if err != nil {
+			t.Fatalf("stdin did not fetch: %v", err)
+		}
+		if tmpl != "i am template" {
+			t.Fatalf("stdin fetched wrong template: %s", tmpl)
+		}
+	}
+}
+
+func TestBuiltinTemplateFetcher(t *testing.T) {
+	ctx := context.Background()
+	fetcher := &BuiltinTemplateFetcher{FS: fstest.MapFS{
+		"one.txt":   {Data: []byte("i am template")},
+		"two.txt":   {Data: []byte("i am another template")},
+		"three.go":  {Data: []byte("package three")},
+		"four/five": {Data: []byte("i am not a template")},
+	}}
+
+	tmpl, err := fetcher.FetchTemplate(ctx, "builtin:one")
 	if err != nil {
-		t.Fatalf("multi fetcher did not succeed: %v", err)
+		t.Fatalf("builtin did not fetch: %v", err)
 	}
 	if tmpl != "i am template" {
-		t.Fatalf("multi fetcher fetched wrong template: %s", tmpl)
+		t.Fatalf("builtin fetched wrong template: %s", tmpl)
+	}
+	for _, path := range []string{"one", "one.txt", "builtin:", "builtin:three", "builtin:four/five", "https://localhost"} {
+		if _, err := fetcher.FetchTemplate(ctx, path); err == nil {
+			t.Fatalf("builtin fetched %s", path)
+		}
+	}
+	_, err = fetcher.FetchTemplate(ctx, "builtin:three")
+	if !strings.Contains(err.Error(), "one, two") {
+		t.Fatalf("builtin did not list the available templates: %v", err)
 	}
 
-	if _, err := (MultiTemplateFetcher{}).FetchTemplate(context.Background(), "template.txt"); err == nil {
-		t.Fatal("multi fetcher tried to work without any fetcher installed")
+	list, err := fetcher.Templates()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(list) != 2 || list[0].Name != "one" || list[1].Name != "two" {
+		t.Fatalf("builtin listed wrong templates: %#v", list)
+	}
+
+	// Every embedded template is listed with a description and can be
+	// fetched.
+	fetcher = &BuiltinTemplateFetcher{}
+	list, err = fetcher.Templates()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(list) < 1 {
+		t.Fatal("no templates are embedded")
+	}
+	for _, builtin := range list {
+		if builtin.Description == "" {
+			t.Fatalf("template %s has no description", builtin.Name)
+		}
+		if _, err := fetcher.FetchTemplate(ctx, BuiltinPrefix+builtin.Name); err != nil {
+			t.Fatalf("failed to fetch template %s: %v", builtin.Name, err)
+		}
 	}
 }
 
@@ -0,0 +1,32 @@
+package directive
+
+import "io"
+
+// Reader is rendered into the same file as Writer.
+//
+//wrapgen:generate template=../../../templates/basic.txt destination=io_gen.go
+type Reader interface {
+	io.Reader
+}
+
+//wrapgen:generate template=../../../templates/basic.txt destination=io_gen.go
+type Writer interface {
+	io.Writer
+}
+
+type (
+	// Closer is rendered on its own with template variables.
+	//
+	//wrapgen:generate template=https://example.com/overrider.txt destination=closer_gen.go var.prefix="Test Closer" legacy-names
+	Closer interface {
+		io.Closer
+	}
+
+	// Seeker has no directive.
+	Seeker interface {
+		io.Seeker
+	}
+)
+
+// Options is not an interface.
+type Options struct{}
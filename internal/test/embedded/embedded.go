@@ -0,0 +1,9 @@
+package embedded
+
+import "github.com/kevinconway/wrapgen/v2/internal/test/embedded/remote"
+
+// Local embeds an interface of another package that embeds an interface from
+// another file.
+type Local interface {
+	remote.Combined
+}
@@ -0,0 +1,9 @@
+package remote
+
+// Combined declares methods out of alphabetical order and embeds an
+// interface declared in another file.
+type Combined interface {
+	Second()
+	First()
+	Other
+}
@@ -0,0 +1,6 @@
+package remote
+
+// Other is embedded by Combined.
+type Other interface {
+	Third()
+}
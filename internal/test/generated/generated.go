@@ -0,0 +1,6 @@
+package generated
+
+// Getter is wrapped by a generated test file.
+type Getter interface {
+	Get() string
+}
@@ -3,6 +3,7 @@
 package happy
 
 import (
+	"context"
 	"io"
 	nethttp "net/http"
 	"os"
@@ -78,4 +79,18 @@ type ThirdPartyInterfaceExtension pflag.Value
 type ThirdPartyInterfaceAlias = pflag.Value
 
 type IndirectThirdPartyInterfaceExtension ThirdPartyInterfaceExtension
-type IndirectThirdPartyInterfaceAlias ThirdPartyInterfaceAlias
\ No newline at end of file
+type IndirectThirdPartyInterfaceAlias ThirdPartyInterfaceAlias
+
+type CollidingInterface interface {
+	Run(start int, w io.Writer, time string) (log error)
+}
+
+type UnnamedInterface interface {
+	Do(context.Context, io.Reader, string, string, *ExportedStruct, *pflag.FlagSet, ...int) (int, bool, error)
+	Blank(_ []byte, _ map[string]int) (io int)
+}
+
+type ExportedInterfaceWithUnexportedMethod interface {
+	a()
+	B(unexportedStruct) *unexportedStruct
+}
@@ -0,0 +1,8 @@
+// Package logger is imported from a path whose last element is not the name
+// of the package.
+package logger
+
+// New creates a logger.
+func New() interface{} {
+	return nil
+}
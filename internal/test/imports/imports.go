@@ -0,0 +1,9 @@
+package imports
+
+type Time int
+
+// Logger has parameters with the same names as the packages a template
+// imports.
+type Logger interface {
+	Log(time Time, log string)
+}
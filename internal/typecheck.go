@@ -0,0 +1,169 @@
+package wrapgen
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// maxTypeErrors is the most type errors reported for a single file.
+const maxTypeErrors = 10
+
+// typeCheck type checks files as part of the package with the given import
+// path. The files are provided to the type checker as an overlay so nothing is
+// written. Only the problems within the files are reported because problems
+// elsewhere in the package are not caused by them.
+func typeCheck(ctx context.Context, pkgPath string, files []*outputFile) error {
+	overlay := make(map[string][]byte, len(files))
+	results := make(map[string]*typeErrors, len(files))
+	var order []string
+	for _, file := range files {
+		name, err := filepath.Abs(file.path)
+		if err != nil {
+			return err
+		}
+		overlay[name] = file.content
+		results[name] = &typeErrors{src: file.content, smap: file.smap}
+		order = append(order, name)
+	}
+	// The package is loaded by its import path rather than its directory
+	// because the directory does not exist until the files are first written.
+	conf := newLoadConfig(ctx, existingDir(filepath.Dir(order[0])))
+	conf.Overlay = overlay
+	pkgs, err := packages.Load(conf, pkgPath)
+	if err != nil {
+		return fmt.Errorf("failed to type check generated code: %v", err)
+	}
+	var (
+		unpositioned []positionedError
+		positioned   bool
+	)
+	for _, pkg := range pkgs {
+		for _, pkgErr := range pkg.Errors {
+			file, line, column := splitPosition(pkgErr.Pos)
+			if file == "" {
+				unpositioned = append(unpositioned, positionedError{msg: pkgErr.Msg})
+				continue
+			}
+			positioned = true
+			result, ok := results[filepath.Clean(file)]
+			if !ok {
+				continue
+			}
+			result.errs = append(result.errs, positionedError{
+				line:   line,
+				column: column,
+				msg:    pkgErr.Msg,
+			})
+		}
+	}
+	// Errors without a position, such as the output of a failed build, are
+	// only reported when there is nothing more precise because they repeat
+	// the errors that have a position.
+	if !positioned && len(unpositioned) > 0 {
+		results[order[0]].errs = unpositioned
+	}
+	var errs []error
+	for _, name := range order {
+		if len(results[name].errs) > 0 {
+			errs = append(errs, results[name])
+		}
+	}
+	if len(errs) == 1 {
+		return errs[0]
+	}
+	if len(errs) > 0 {
+		return multiError(errs)
+	}
+	return nil
+}
+
+// existingDir returns dir or the closest of its parents that exists.
+func existingDir(dir string) string {
+	for {
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return dir
+		}
+		dir = parent
+	}
+}
+
+// splitPosition interprets a position of the form file:line:col or file:line.
+// The line and column are zero if they are missing.
+func splitPosition(pos string) (string, int, int) {
+	if pos == "" || pos == "-" {
+		return "", 0, 0
+	}
+	var numbers []int
+	for len(numbers) < 2 {
+		offset := strings.LastIndex(pos, ":")
+		if offset < 0 {
+			break
+		}
+		n, err := strconv.Atoi(pos[offset+1:])
+		if err != nil {
+			break
+		}
+		numbers = append([]int{n}, numbers...)
+		pos = pos[:offset]
+	}
+	switch len(numbers) {
+	case 2:
+		return pos, numbers[0], numbers[1]
+	case 1:
+		return pos, numbers[0], 0
+	}
+	return pos, 0, 0
+}
+
+type positionedError struct {
+	line   int
+	column int
+	msg    string
+}
+
+// typeErrors describes generated code that does not type check. Each error is
+// shown with the generated line that contains it and, if a source map is
+// available, the part of the template that produced it.
+type typeErrors struct {
+	src  []byte
+	errs []positionedError
+	smap *sourceMap
+}
+
+func (e *typeErrors) Error() string {
+	var buf bytes.Buffer
+	_, _ = buf.WriteString("generated code does not type check:")
+	for offset, err := range e.errs {
+		if offset == maxTypeErrors {
+			_, _ = fmt.Fprintf(&buf, "\n(and %d more errors)", len(e.errs)-maxTypeErrors)
+			break
+		}
+		location := ""
+		if e.smap != nil && err.line > 0 {
+			location = e.smap.locateOutput(e.src, err.line, err.column)
+		}
+		switch {
+		case location != "":
+			_, _ = fmt.Fprintf(&buf, "\n%s: %s", location, err.msg)
+		case err.line > 0:
+			_, _ = fmt.Fprintf(&buf, "\n%d:%d: %s", err.line, err.column, err.msg)
+		default:
+			_, _ = fmt.Fprintf(&buf, "\n%s", err.msg)
+		}
+		if err.line > 0 {
+			writeContext(&buf, e.src, err.line, 0)
+		}
+	}
+	return buf.String()
+}
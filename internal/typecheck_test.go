@@ -0,0 +1,108 @@
+package wrapgen
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSplitPosition(t *testing.T) {
+	testCases := []struct {
+		pos    string
+		file   string
+		line   int
+		column int
+	}{
+		{pos: "/a/b.go:12:5", file: "/a/b.go", line: 12, column: 5},
+		{pos: "/a/b.go:12", file: "/a/b.go", line: 12},
+		{pos: `C:\a\b.go:3:4`, file: `C:\a\b.go`, line: 3, column: 4},
+		{pos: "-"},
+		{pos: ""},
+	}
+	for _, testCase := range testCases {
+		file, line, column := splitPosition(testCase.pos)
+		if file != testCase.file || line != testCase.line || column != testCase.column {
+			t.Errorf("%s: unexpected %s %d %d", testCase.pos, file, line, column)
+		}
+	}
+}
+
+// newTestPackage creates a package within the module so that it can be type
+// checked. The package declares a type T.
+func newTestPackage(t *testing.T) string {
+	dir, err := ioutil.TempDir("test", "typecheck")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	src := "package typecheck\n\ntype T struct{}\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "t.go"), []byte(src), 0644); err != nil {
+		t.Fatal(err.Error())
+	}
+	return dir
+}
+
+func TestTypeCheck(t *testing.T) {
+	dir := newTestPackage(t)
+	defer os.RemoveAll(dir)
+	dest := filepath.Join(dir, "gen.go")
+	dst, err := DestinationFromFile(dest)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	good := "package typecheck\n\nimport \"io\"\n\nfunc (T) Read(p []byte) (int, error) { return 0, nil }\n\nvar _ io.Reader = T{}\n"
+	if err := typeCheck(context.Background(), dst.Path, []*outputFile{{path: dest, content: []byte(good)}}); err != nil {
+		t.Fatalf("expected valid output to type check: %v", err)
+	}
+	bad := "package typecheck\n\nimport \"io\"\n\nvar _ io.Reader = T{}\n"
+	err = typeCheck(context.Background(), dst.Path, []*outputFile{{path: dest, content: []byte(bad)}})
+	if err == nil {
+		t.Fatal("expected a type that does not implement the interface to fail")
+	}
+	if !strings.Contains(err.Error(), "5:19: cannot use T{}") || !strings.Contains(err.Error(), ">    5 | var _ io.Reader = T{}") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatal("type checking wrote the destination")
+	}
+}
+
+func TestRunnerTypeCheck(t *testing.T) {
+	dir := newTestPackage(t)
+	defer os.RemoveAll(dir)
+	dest, err := filepath.Abs(filepath.Join(dir, "gen.go"))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	var stderr bytes.Buffer
+	runner, _ := newTestRunner(t, "package #! .Name !#\n#! range .Interfaces !#\nvar _ #! .SrcType !# = T{}\n#! end !#")
+	runner.Stderr = &stderr
+	job := readerJob(dest, "")
+	job.Template = "assert.txt"
+	err = runner.Run(context.Background(), []*Job{job})
+	if err == nil {
+		t.Fatal("expected output that does not type check to fail")
+	}
+	if !strings.Contains(err.Error(), "assert.txt:3 (interface io.Reader): cannot use T{}") {
+		t.Fatalf("expected the error to refer to the template but got %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Fatal("output that does not type check was written")
+	}
+
+	runner.Force = true
+	if err := runner.Run(context.Background(), []*Job{job}); err != nil {
+		t.Fatalf("expected force to write the output: %v", err)
+	}
+	if _, err := os.Stat(dest); err != nil {
+		t.Fatal("forced output was not written")
+	}
+	if !strings.Contains(stderr.String(), "warning: generated code does not type check") {
+		t.Fatalf("expected a warning but got %q", stderr.String())
+	}
+}
@@ -0,0 +1,87 @@
+package wrapgen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// writeFile replaces the contents of a file without ever leaving it partially
+// written. The content is written to a temporary file in the same directory
+// which is then renamed over the destination. Nothing is written if the file
+// already has the same content so that its modification time, and any build
+// caches that depend on it, are left alone. Missing parent directories are
+// created.
+func writeFile(name string, content []byte) error {
+	existing, err := ioutil.ReadFile(name)
+	if err == nil && bytes.Equal(existing, content) {
+		return nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	// Existing files keep their permissions. New files are readable by all
+	// which matches the usual result of creating a file with the default
+	// umask.
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(name); err == nil {
+		mode = info.Mode().Perm()
+	}
+	dir := filepath.Dir(name)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(dir, "."+filepath.Base(name)+".tmp")
+	if err != nil {
+		return err
+	}
+	// The temporary file is removed unless the rename succeeds.
+	renamed := false
+	defer func() {
+		if !renamed {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), name); err != nil {
+		return err
+	}
+	renamed = true
+	return nil
+}
+
+// replaceDir moves the directory src into the place of dst. The previous
+// content of dst is moved into a new temporary directory beside it so that it
+// can be restored if the move fails, and is removed otherwise.
+func replaceDir(src string, dst string) error {
+	staging, err := ioutil.TempDir(filepath.Dir(dst), "."+filepath.Base(dst)+".old")
+	if err != nil {
+		return err
+	}
+	old := filepath.Join(staging, filepath.Base(dst))
+	if err := os.Rename(dst, old); err != nil && !os.IsNotExist(err) {
+		_ = os.Remove(staging)
+		return err
+	}
+	if err := os.Rename(src, dst); err != nil {
+		if restoreErr := os.Rename(old, dst); restoreErr == nil || os.IsNotExist(restoreErr) {
+			_ = os.RemoveAll(staging)
+		}
+		return err
+	}
+	return os.RemoveAll(staging)
+}
@@ -0,0 +1,120 @@
+package wrapgen
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWriteFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	name := filepath.Join(dir, "a", "b", "gen.go")
+	if err := writeFile(name, []byte("one")); err != nil {
+		t.Fatalf("failed to create a file in a missing directory: %v", err)
+	}
+	assertContent(t, name, "one")
+
+	// An unchanged file is not written so its modification time stays the
+	// same.
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(name, past, past); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := writeFile(name, []byte("one")); err != nil {
+		t.Fatal(err.Error())
+	}
+	info, err := os.Stat(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !info.ModTime().Equal(past) {
+		t.Fatalf("unchanged file was written at %v", info.ModTime())
+	}
+
+	if err := os.Chmod(name, 0600); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := writeFile(name, []byte("two")); err != nil {
+		t.Fatal(err.Error())
+	}
+	assertContent(t, name, "two")
+	info, err = os.Stat(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Fatalf("expected the permissions to be kept but got %v", info.Mode())
+	}
+
+	// A failed write leaves no temporary files behind.
+	if err := writeFile(filepath.Join(name, "child.go"), []byte("three")); err == nil {
+		t.Fatal("expected writing beneath a file to fail")
+	}
+	files, err := ioutil.ReadDir(filepath.Dir(name))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(files) != 1 {
+		t.Fatalf("expected only the destination but found %d files", len(files))
+	}
+}
+
+func assertContent(t *testing.T, name string, expected string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(name)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if string(b) != expected {
+		t.Fatalf("expected %q but got %q", expected, string(b))
+	}
+}
+
+func TestReplaceDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "wrapgen")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	dst := filepath.Join(dir, "dst")
+	// An interrupted replacement may leave its previous content behind.
+	stale := filepath.Join(dir, "src.old")
+	for _, name := range []string{filepath.Join(src, "new.txt"), filepath.Join(dst, "old.txt"), filepath.Join(stale, "dst", "old.txt")} {
+		if err := writeFile(name, []byte(filepath.Base(name))); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := replaceDir(src, dst); err != nil {
+		t.Fatal(err.Error())
+	}
+	assertContent(t, filepath.Join(dst, "new.txt"), "new.txt")
+	if _, err := os.Stat(filepath.Join(dst, "old.txt")); !os.IsNotExist(err) {
+		t.Fatal("expected the previous content to be removed")
+	}
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(files) != 2 {
+		t.Fatalf("expected only the destination and the stale directory but found %d files", len(files))
+	}
+
+	// A missing destination is created.
+	if err := writeFile(filepath.Join(src, "new.txt"), []byte("again")); err != nil {
+		t.Fatal(err.Error())
+	}
+	missing := filepath.Join(dir, "missing")
+	if err := replaceDir(src, missing); err != nil {
+		t.Fatal(err.Error())
+	}
+	assertContent(t, filepath.Join(missing, "new.txt"), "again")
+}
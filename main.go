@@ -1,98 +1,538 @@
 package main
 
 import (
-	"bytes"
 	"context"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
 	"os"
-	"text/template"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
 	"time"
 
-	"github.com/Masterminds/sprig"
 	wrapgen "github.com/kevinconway/wrapgen/v2/internal"
 	"github.com/spf13/pflag"
 )
 
 func main() {
-	ctx := context.Background()
-	fs := pflag.NewFlagSet(os.Args[0], pflag.ExitOnError)
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "run":
+			os.Exit(run(os.Args[0]+" run", os.Args[2:]))
+		case "generate":
+			os.Exit(generate(os.Args[0]+" generate", os.Args[2:]))
+		case "regen":
+			os.Exit(regen(os.Args[0]+" regen", os.Args[2:]))
+		case "templates":
+			os.Exit(templates(os.Args[0]+" templates", os.Args[2:]))
+		}
+	}
+	os.Exit(render(os.Args[0], os.Args[1:]))
+}
+
+// render is the default command which renders a single template.
+func render(name string, args []string) int {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
 	srcPkg := fs.String("source", "", "The import path of the package to render.")
-	destPkg := fs.String("package", "", "The destination package path or name that the resulting file will be in. Defaults to the source package.")
-	templatePath := fs.String("template", "", "The template to render.")
+	destPkg := fs.String("package", "", "The destination package path or name that the resulting file will be in. Defaults to the package of the destination file or, when writing to STDOUT, the source package.")
+	templatePath := fs.String("template", "", "The template to render. This is a file, a URL, or the name of a builtin template such as builtin:logtime.")
+	templateSHA256 := fs.String("template-sha256", "", "Fail unless the content of the template has this sha256.")
 	ifaceName := fs.StringSlice("interface", nil, "The name of the interface to render.")
 	leftDelim := fs.String("leftdelim", "#!", "Left-hand side delimiter for the template.")
 	rightDelim := fs.String("rightdelim", "!#", "Right-hand side delimiter for the template.")
 	timeout := fs.Duration("timeout", time.Minute, "Maximum runtime allowed for rendering.")
-	destination := fs.String("destination", "-", "Filename for the rendered template. Defaults to STDOUT.")
-	_ = fs.Parse(os.Args[1:])
+	destination := fs.String("destination", "-", "Filename for the rendered template, or a pattern such as '{{ .Interface.Name | snakecase }}_gen.go' that renders each interface into its own file. Defaults to STDOUT.")
+	legacyNames := fs.Bool("legacy-names", false, "Name unnamed parameters and results paramN and resultN rather than deriving names from their types.")
+	vars := fs.StringToString("var", nil, "A key=value pair made available to the template as .Vars.key. May be repeated.")
+	license := fs.String("license", "", "A file containing a license to place at the top of the output as a comment.")
+	output := newOutputFlags(fs)
+	fetch := newFetchFlags(fs)
+	_ = fs.Parse(args)
 
-	ctx, cancel := context.WithTimeout(ctx, *timeout)
+	ctx, cancel := withTimeout(context.Background(), *timeout)
 	defer cancel()
-	go func() {
-		<-ctx.Done()
-		if ctx.Err() == context.DeadlineExceeded {
-			_, _ = fmt.Fprintln(os.Stderr, "command timed out")
-			os.Exit(1)
-		}
-	}()
 
 	if *templatePath == "" {
 		fmt.Fprintln(os.Stderr, "no --template value set")
-		os.Exit(1)
+		return 1
+	}
+	// When run by go generate the source, interface, and destination default
+	// to the package, type, and directory of the go:generate directive.
+	gen, ok, err := wrapgen.GoGenerateFromEnv(os.Getenv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if ok {
+		if *srcPkg == "" {
+			*srcPkg = "."
+		}
+		if len(*ifaceName) < 1 {
+			name, err := gen.NextType(".")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "failed to find the interface for the go:generate directive: %v\n", err)
+				return 1
+			}
+			*ifaceName = []string{name}
+		}
+		if !fs.Changed("destination") {
+			*destination = wrapgen.DefaultDestination(*templatePath, *ifaceName)
+		}
 	}
 	if *srcPkg == "" {
 		fmt.Fprintln(os.Stderr, "no --source value set")
-		os.Exit(1)
+		return 1
 	}
-	var output io.Writer = os.Stdout
 	if len(*ifaceName) < 1 {
 		fmt.Fprintln(os.Stderr, "no --interface value set")
-		os.Exit(1)
+		return 1
+	}
+
+	runner := &wrapgen.Runner{
+		Stdout:  os.Stdout,
+		Command: renderCommand,
+	}
+	if ok {
+		runner.Command = func(*wrapgen.Job) string {
+			return "go generate " + gen.File
+		}
+	}
+	output.apply(runner)
+	if err := fetch.apply(runner, "."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	err = runner.Run(ctx, []*wrapgen.Job{{
+		Source:         *srcPkg,
+		Interfaces:     *ifaceName,
+		Template:       *templatePath,
+		TemplateSHA256: *templateSHA256,
+		Destination:    *destination,
+		Package:        *destPkg,
+		LeftDelim:      *leftDelim,
+		RightDelim:     *rightDelim,
+		Vars:           *vars,
+		LegacyNames:    *legacyNames,
+		License:        *license,
+	}})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// run renders every job listed in a config file.
+func run(name string, args []string) int {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
+	configPath := fs.String("config", "", fmt.Sprintf("The config file listing the jobs to render. Defaults to the first of %v found in the working directory.", wrapgen.ConfigFiles))
+	concurrency := fs.Int("concurrency", 0, "Maximum number of jobs rendered at once. Overrides the config file. Defaults to the number of CPUs.")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Maximum runtime allowed for rendering all jobs.")
+	output := newOutputFlags(fs)
+	fetch := newFetchFlags(fs)
+	_ = fs.Parse(args)
+
+	ctx, cancel := withTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	if *configPath == "" {
+		for _, candidate := range wrapgen.ConfigFiles {
+			if _, err := os.Stat(candidate); err == nil {
+				*configPath = candidate
+				break
+			}
+		}
+	}
+	if *configPath == "" {
+		fmt.Fprintf(os.Stderr, "no --config value set and none of %v found\n", wrapgen.ConfigFiles)
+		return 1
+	}
+	conf, err := wrapgen.LoadConfig(*configPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to load config: %v\n", err)
+		return 1
+	}
+	if *concurrency > 0 {
+		conf.Concurrency = *concurrency
 	}
 
-	fetcher := wrapgen.MultiTemplateFetcher{
-		&wrapgen.HTTPTemplateFetcher{
-			Client: http.DefaultClient,
+	runner := &wrapgen.Runner{
+		Dir:         filepath.Dir(*configPath),
+		Concurrency: conf.Concurrency,
+		Stdout:      os.Stdout,
+		Command: func(*wrapgen.Job) string {
+			return "wrapgen run --config " + shellQuote(*configPath)
 		},
-		&wrapgen.FSTemplateFetcher{
-			ReadFn: ioutil.ReadFile,
+	}
+	output.apply(runner)
+	if err := fetch.apply(runner, filepath.Dir(*configPath)); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := runner.Run(ctx, conf.Jobs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// generate renders every //wrapgen:generate directive found in the packages
+// matching the given patterns.
+func generate(name string, args []string) int {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s [packages]:\n", name)
+		fs.PrintDefaults()
+	}
+	concurrency := fs.Int("concurrency", 0, "Maximum number of jobs rendered at once. Defaults to the number of CPUs.")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Maximum runtime allowed for rendering all jobs.")
+	output := newOutputFlags(fs)
+	fetch := newFetchFlags(fs)
+	_ = fs.Parse(args)
+
+	ctx, cancel := withTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	patterns := fs.Args()
+	if len(patterns) < 1 {
+		patterns = []string{"./..."}
+	}
+	jobs, err := wrapgen.FindDirectives(ctx, "", patterns...)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "failed to find directives: %v\n", err)
+		return 1
+	}
+
+	runner := &wrapgen.Runner{
+		Concurrency: *concurrency,
+		Stdout:      os.Stdout,
+		Command: func(job *wrapgen.Job) string {
+			return "wrapgen generate " + job.Source
 		},
 	}
-	templateString, err := fetcher.FetchTemplate(ctx, *templatePath)
+	output.apply(runner)
+	if err := fetch.apply(runner, "."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := runner.Run(ctx, jobs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// regen renders every file generated by wrapgen in the packages matching the
+// given patterns again using the parameters recorded in their headers.
+func regen(name string, args []string) int {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s [packages]:\n", name)
+		fs.PrintDefaults()
+	}
+	concurrency := fs.Int("concurrency", 0, "Maximum number of jobs rendered at once. Defaults to the number of CPUs.")
+	timeout := fs.Duration("timeout", 5*time.Minute, "Maximum runtime allowed for rendering all jobs.")
+	output := newOutputFlags(fs)
+	fetch := newFetchFlags(fs)
+	_ = fs.Parse(args)
+
+	ctx, cancel := withTimeout(context.Background(), *timeout)
+	defer cancel()
+
+	patterns := fs.Args()
+	if len(patterns) < 1 {
+		patterns = []string{"./..."}
+	}
+	files, err := wrapgen.FindGenerated(ctx, "", patterns...)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to fetch template: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "failed to find generated files: %v\n", err)
+		return 1
 	}
-	tmpl, err := template.New("wrapgen").Funcs(sprig.TxtFuncMap()).Delims(*leftDelim, *rightDelim).Parse(templateString)
+	orphans, err := wrapgen.FindOrphans(ctx, "", files)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to parse template: %v\n", err)
-		os.Exit(1)
+		fmt.Fprintf(os.Stderr, "failed to load source packages: %v\n", err)
+		return 1
 	}
 
-	pkg, err := wrapgen.LoadPackage(ctx, *srcPkg, *destPkg, *ifaceName)
-	if err != nil {
-		fmt.Fprintf(os.Stderr, "failed to interpret package: %v\n", err)
-		os.Exit(1)
+	// Each file keeps the command that originally generated it so that the
+	// header only changes if the output does.
+	var jobs []*wrapgen.Job
+	commands := make(map[*wrapgen.Job]string)
+	for _, file := range files {
+		if reason, ok := orphans[file.Path]; ok {
+			fmt.Fprintf(os.Stderr, "%s: orphaned: %s\n", relativePath(file.Path), reason)
+			continue
+		}
+		jobs = append(jobs, file.Job)
+		commands[file.Job] = file.Command
+	}
+	runner := &wrapgen.Runner{
+		Concurrency: *concurrency,
+		Stdout:      os.Stdout,
+		Command: func(job *wrapgen.Job) string {
+			return commands[job]
+		},
+	}
+	output.apply(runner)
+	if err := fetch.apply(runner, "."); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if err := runner.Run(ctx, jobs); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if len(orphans) > 0 {
+		return 1
 	}
+	return 0
+}
 
-	var buff bytes.Buffer
-	if err := tmpl.Execute(&buff, pkg); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to render template: %v\n", err)
-		os.Exit(1)
+// templates lists and prints the templates that are built into wrapgen, and
+// vendors the remote templates recorded in the lock file.
+func templates(name string, args []string) int {
+	fs := pflag.NewFlagSet(name, pflag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(os.Stderr, "Usage of %s:\n", name)
+		fmt.Fprintf(os.Stderr, "  %s list         List the builtin templates.\n", name)
+		fmt.Fprintf(os.Stderr, "  %s show <name>  Print a builtin template.\n", name)
+		fmt.Fprintf(os.Stderr, "  %s vendor       Copy the remote templates in %s into %s.\n", name, wrapgen.LockFileName, wrapgen.VendorDirName)
+		fs.PrintDefaults()
 	}
+	timeout := fs.Duration("timeout", time.Minute, "Maximum runtime allowed for vendoring.")
+	fetch := newFetchFlags(fs)
+	_ = fs.Parse(args)
 
-	if *destination != "-" {
-		f, err := os.Create(*destination)
+	fetcher := &wrapgen.BuiltinTemplateFetcher{}
+	switch {
+	case fs.NArg() == 1 && fs.Arg(0) == "list":
+		list, err := fetcher.Templates()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "faild to create destination file: %v\n", err)
-			os.Exit(1)
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, t := range list {
+			fmt.Fprintf(w, "%s%s\t%s\n", wrapgen.BuiltinPrefix, t.Name, t.Description)
+		}
+		_ = w.Flush()
+		return 0
+	case fs.NArg() == 2 && fs.Arg(0) == "show":
+		path := fs.Arg(1)
+		if !strings.HasPrefix(path, wrapgen.BuiltinPrefix) {
+			path = wrapgen.BuiltinPrefix + path
+		}
+		text, err := fetcher.FetchTemplate(context.Background(), path)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Print(text)
+		return 0
+	case fs.NArg() == 1 && fs.Arg(0) == "vendor":
+		ctx, cancel := withTimeout(context.Background(), *timeout)
+		defer cancel()
+		lock, err := fetch.lock(".")
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
 		}
-		defer f.Close()
-		output = f
+		dir := filepath.Join(filepath.Dir(lock.Path), wrapgen.VendorDirName)
+		if err := wrapgen.Vendor(ctx, fetch.fetcher(), lock, dir); err != nil {
+			fmt.Fprintf(os.Stderr, "failed to vendor templates: %v\n", err)
+			return 1
+		}
+		return 0
+	}
+	fs.Usage()
+	return 2
+}
+
+// relativePath shortens a path to be relative to the working directory when
+// it is within it.
+func relativePath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		return path
+	}
+	return rel
+}
+
+// outputFlags are shared by every command and control what is done with the
+// rendered output.
+type outputFlags struct {
+	check    *bool
+	diff     *bool
+	raw      *bool
+	force    *bool
+	noHeader *bool
+}
+
+func newOutputFlags(fs *pflag.FlagSet) *outputFlags {
+	return &outputFlags{
+		check:    fs.Bool("check", false, "Exit with an error if any destination file is missing or out of date rather than writing it."),
+		diff:     fs.Bool("diff", false, "Print a unified diff of the changes to each destination file rather than writing it."),
+		raw:      fs.Bool("raw", false, "Write the rendered template as is rather than formatting it with gofmt and goimports."),
+		force:    fs.Bool("force", false, "Write destination files even if they do not type check as part of their package."),
+		noHeader: fs.Bool("no-header", false, "Leave out the comment that marks the output as generated and records how it was made."),
+	}
+}
+
+func (f *outputFlags) apply(runner *wrapgen.Runner) {
+	runner.Check = *f.check
+	runner.Diff = *f.diff
+	runner.Raw = *f.raw
+	runner.Force = *f.force
+	runner.NoHeader = *f.noHeader
+	runner.Stderr = os.Stderr
+}
+
+// renderCommand reproduces the flags of a job rendered by the default command
+// in a fixed order so that the header does not depend on how they were given.
+func renderCommand(job *wrapgen.Job) string {
+	args := []string{
+		"wrapgen",
+		"--source", job.Source,
+		"--interface", strings.Join(job.Interfaces, ","),
+		"--template", job.Template,
+	}
+	if job.TemplateSHA256 != "" {
+		args = append(args, "--template-sha256", job.TemplateSHA256)
+	}
+	if job.Destination != "" && job.Destination != "-" {
+		args = append(args, "--destination", job.Destination)
+	}
+	if job.Package != "" {
+		args = append(args, "--package", job.Package)
+	}
+	if job.LeftDelim != "#!" {
+		args = append(args, "--leftdelim", job.LeftDelim)
+	}
+	if job.RightDelim != "!#" {
+		args = append(args, "--rightdelim", job.RightDelim)
+	}
+	if job.LegacyNames {
+		args = append(args, "--legacy-names")
+	}
+	if job.License != "" {
+		args = append(args, "--license", job.License)
+	}
+	names := make([]string, 0, len(job.Vars))
+	for name := range job.Vars {
+		names = append(names, name)
 	}
+	sort.Strings(names)
+	for _, name := range names {
+		args = append(args, "--var", name+"="+job.Vars[name])
+	}
+	for offset, arg := range args {
+		args[offset] = shellQuote(arg)
+	}
+	return strings.Join(args, " ")
+}
+
+// shellQuote quotes an argument for a POSIX shell if it contains anything
+// other than characters that are always safe.
+func shellQuote(arg string) string {
+	if arg != "" && strings.Trim(arg, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_=+,./:@%") == "" {
+		return arg
+	}
+	return "'" + strings.Replace(arg, "'", `'"'"'`, -1) + "'"
+}
+
+// fetchFlags are shared by every command and control how templates are
+// fetched.
+type fetchFlags struct {
+	offline      *bool
+	allowHosts   *[]string
+	fetchTimeout *time.Duration
+	fetchRetries *int
+	maxSize      *int64
+}
+
+func newFetchFlags(fs *pflag.FlagSet) *fetchFlags {
+	return &fetchFlags{
+		offline:      fs.Bool("offline", false, "Fetch remote templates only from the cache rather than the network."),
+		allowHosts:   fs.StringSlice("allow-host", nil, "A host that remote templates may be fetched from. May be repeated. Defaults to any host."),
+		fetchTimeout: fs.Duration("fetch-timeout", 30*time.Second, "Maximum runtime allowed for each request for a remote template."),
+		fetchRetries: fs.Int("fetch-retries", 2, "Number of times a request for a remote template is repeated if the server fails with a 5xx or 429 status."),
+		maxSize:      fs.Int64("max-template-size", wrapgen.DefaultMaxTemplateBytes, "Maximum size in bytes of a remote template."),
+	}
+}
+
+// fetcher returns a fetcher for every kind of template path that the commands
+// accept. Remote templates are cached when a cache directory is available.
+func (f *fetchFlags) fetcher() *wrapgen.SchemeTemplateFetcher {
+	fetcher := &wrapgen.SchemeTemplateFetcher{}
+	files := &wrapgen.FSTemplateFetcher{ReadFn: ioutil.ReadFile}
+	fetcher.Register("", files)
+	fetcher.Register("file", files)
+	cacheDir, _ := wrapgen.DefaultCacheDir()
+	web := &wrapgen.HTTPTemplateFetcher{
+		Client:       http.DefaultClient,
+		CacheDir:     cacheDir,
+		Offline:      *f.offline,
+		MaxBytes:     *f.maxSize,
+		AllowedHosts: *f.allowHosts,
+		Timeout:      *f.fetchTimeout,
+		Retries:      *f.fetchRetries,
+	}
+	fetcher.Register("http", web)
+	fetcher.Register("https", web)
+	fetcher.Register("builtin", &wrapgen.BuiltinTemplateFetcher{})
+	fetcher.Register(wrapgen.StdinPath, &wrapgen.StdinTemplateFetcher{Reader: os.Stdin})
+	return fetcher
+}
+
+// lock reads the lock file that applies to dir.
+func (f *fetchFlags) lock(dir string) (*wrapgen.Lock, error) {
+	path, err := wrapgen.FindLock(dir)
+	if err != nil {
+		return nil, err
+	}
+	lock, err := wrapgen.ReadLock(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read lock file: %v", err)
+	}
+	return lock, nil
+}
+
+// apply installs the fetcher and the lock file that applies to dir. Remote
+// templates are loaded from the vendor directory beside the lock file when
+// they have been vendored.
+func (f *fetchFlags) apply(runner *wrapgen.Runner, dir string) error {
+	lock, err := f.lock(dir)
+	if err != nil {
+		return err
+	}
+	fetcher := f.fetcher()
+	vendored := filepath.Join(filepath.Dir(lock.Path), wrapgen.VendorDirName)
+	for _, scheme := range []string{"http", "https"} {
+		fetcher.Register(scheme, &wrapgen.VendoredTemplateFetcher{
+			Dir:     vendored,
+			Fetcher: fetcher.Lookup(scheme),
+		})
+	}
+	runner.Fetcher = fetcher
+	runner.Lock = lock
+	return nil
+}
 
-	_, _ = io.Copy(output, &buff)
+// withTimeout exits the process if rendering takes longer than the timeout.
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	go func() {
+		<-ctx.Done()
+		if ctx.Err() == context.DeadlineExceeded {
+			_, _ = fmt.Fprintln(os.Stderr, "command timed out")
+			os.Exit(1)
+		}
+	}()
+	return ctx, cancel
 }
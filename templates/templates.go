@@ -0,0 +1,19 @@
+// Package templates contains the templates that are built into wrapgen. Each
+// template is a file named after the template with a .txt extension.
+package templates
+
+import "embed"
+
+// FS holds the content of every built in template.
+//
+//go:embed *.txt
+var FS embed.FS
+
+// Descriptions summarizes each built in template by name.
+var Descriptions = map[string]string{
+	"basic":     "Wraps each interface in a struct that calls through to the wrapped value.",
+	"fake":      "Implements each interface with a function field for each method for use in tests.",
+	"logtime":   "Wraps each interface in a struct that logs the latency of every call.",
+	"noop":      "Implements each interface with methods that do nothing and return zero values.",
+	"overrider": "Wraps each interface in a struct with a function field that can replace each method.",
+}